@@ -4,6 +4,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/xconnio/wampproto-go/auth"
 	"github.com/xconnio/wampproto-go/messages"
@@ -18,18 +20,65 @@ const (
 	AcceptorStateWelcomeSent
 )
 
-var RouterRoles = map[string]any{ //nolint:gochecknoglobals
-	"dealer": map[string]any{
-		"features": map[string]any{
-			FeatureProgressiveCallInvocations: true,
-			FeatureCallCancelling:             true,
-		},
-	},
-	"broker": map[string]any{
-		"features": map[string]any{
-			FeaturePublisherExclusion: true,
-		},
-	},
+// RouterRoles are the roles announced by an Acceptor created without AcceptorOptions.Roles
+// in versions that shared them between all acceptors.
+//
+// Deprecated: changing it has no effect, set AcceptorOptions.Roles instead.
+var RouterRoles = DefaultRouterRoles() //nolint:gochecknoglobals
+
+// DefaultRouterRoles returns the roles an Acceptor announces unless AcceptorOptions.Roles
+// is set, the features of a Dealer and Broker with default options. Every call returns a
+// new map that may be modified freely.
+func DefaultRouterRoles() map[string]any {
+	roles := NewDealer().Roles()
+	for role, details := range NewBroker().Roles() {
+		roles[role] = details
+	}
+
+	return roles
+}
+
+// AcceptorOptions configures an Acceptor, the zero value gives the defaults.
+type AcceptorOptions struct {
+	// Roles announced in WELCOME and negotiated with the roles from HELLO, defaults to
+	// DefaultRouterRoles.
+	Roles map[string]any
+	// RealmRoles, if set, returns the roles for the realm the client joins and overrides
+	// Roles, so that realms with differently configured dealers and brokers can announce
+	// what each of them supports.
+	RealmRoles func(realm string) map[string]any
+	// RealmRegistry, if set, is consulted for the realm in HELLO. Clients asking for an
+	// unknown realm are answered with ABORT wamp.error.no_such_realm, the realm it resolves
+	// to is the one passed to the authenticator and joined.
+	RealmRegistry RealmRegistry
+	// AllowedRealms is a shorthand for a RealmRegistry of StaticRealms, it is ignored if
+	// RealmRegistry is set.
+	AllowedRealms []string
+	// AutoCreateRealms creates unknown realms on first join instead of rejecting the
+	// client, the RealmRegistry has to be a RealmCreator for that.
+	AutoCreateRealms bool
+	// IDGenerator generates session IDs, defaults to RandomIDGenerator.
+	IDGenerator IDGenerator
+	// Now is the clock for the creation time of sessions and the challenge TTL, defaults
+	// to time.Now.
+	Now func() time.Time
+	// ChallengeTTL, if positive, is how long a client has to answer a CHALLENGE, later
+	// AUTHENTICATE messages are answered with ABORT wamp.error.authentication_failed.
+	ChallengeTTL time.Duration
+	// AuthProvider is announced in WAMP-CRA challenges and WELCOME for responses that
+	// don't name their own authprovider, defaults to "static".
+	AuthProvider string
+	// Logger defaults to discarding everything.
+	Logger *slog.Logger
+	// MaxPayloadSize, if positive, is the size in bytes of the largest message Receive
+	// accepts.
+	MaxPayloadSize int
+	SessionStore   SessionStore
+	URIValidation  URIValidationMode
+	// ChannelBinding of the transport the client is connected over, see
+	// auth.TLSChannelBinding. CryptoSign clients asking for channel binding are rejected
+	// unless it is set to the type they asked for.
+	ChannelBinding *auth.ChannelBinding
 }
 
 type defaultAuthenticator struct{}
@@ -50,17 +99,46 @@ type Acceptor struct {
 	state         acceptorState
 	serializer    serializers.Serializer
 	authenticator auth.ServerAuthenticator
+	store         SessionStore
+	uriValidation URIValidationMode
+	roles         map[string]any
+	realmRoles    func(realm string) map[string]any
+	realms        RealmRegistry
+	autoCreate    bool
+	idGen         IDGenerator
+	now           func() time.Time
+	logger        *slog.Logger
+	maxPayload    int
+	binding       *auth.ChannelBinding
+	challengeTTL  time.Duration
+	authProvider  string
 	// cached items
-	authMethod auth.Method
-	hello      *messages.Hello
-	request    auth.Request
-	response   auth.Response
-	challenge  string
+	authMethod  auth.Method
+	hello       *messages.Hello
+	request     auth.Request
+	response    auth.Response
+	challenge   string
+	challengeAt time.Time
+	sessionID   uint64
 
 	sessionDetails *SessionDetails
 }
 
 func NewAcceptor(serializer serializers.Serializer, authenticator auth.ServerAuthenticator) *Acceptor {
+	return NewAcceptorWithOptions(serializer, authenticator, nil)
+}
+
+func NewAcceptorWithOptions(serializer serializers.Serializer, authenticator auth.ServerAuthenticator,
+	options *AcceptorOptions) *Acceptor {
+	if options == nil {
+		options = &AcceptorOptions{}
+	}
+
+	roles := options.Roles
+	if roles == nil {
+		roles = DefaultRouterRoles()
+	}
+
 	if authenticator == nil {
 		authenticator = &defaultAuthenticator{}
 	}
@@ -69,17 +147,72 @@ func NewAcceptor(serializer serializers.Serializer, authenticator auth.ServerAut
 		serializer = &serializers.JSONSerializer{}
 	}
 
+	realms := options.RealmRegistry
+	if realms == nil && len(options.AllowedRealms) > 0 {
+		realms = NewStaticRealms(options.AllowedRealms...)
+	}
+
+	var idGen IDGenerator = RandomIDGenerator{}
+	if options.IDGenerator != nil {
+		idGen = options.IDGenerator
+	}
+
+	now := options.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = discardLogger()
+	}
+
+	authProvider := options.AuthProvider
+	if authProvider == "" {
+		authProvider = "static"
+	}
+
 	return &Acceptor{
 		serializer:    serializer,
 		authenticator: authenticator,
 		state:         AcceptorStateNone,
+		store:         options.SessionStore,
+		uriValidation: options.URIValidation,
+		roles:         roles,
+		realmRoles:    options.RealmRoles,
+		realms:        realms,
+		autoCreate:    options.AutoCreateRealms,
+		idGen:         idGen,
+		now:           now,
+		logger:        logger,
+		maxPayload:    options.MaxPayloadSize,
+		binding:       options.ChannelBinding,
+		challengeTTL:  options.ChallengeTTL,
+		authProvider:  authProvider,
 	}
 }
 
+// SetSessionStore enables session resumption. Clients that ask for it in HELLO get a
+// resume token in WELCOME, and a valid token reattaches them to their earlier session ID.
+func (a *Acceptor) SetSessionStore(store SessionStore) {
+	a.store = store
+}
+
+// SetURIValidation sets how the realm URI in HELLO is validated, the default is
+// URIValidationLoose.
+func (a *Acceptor) SetURIValidation(mode URIValidationMode) {
+	a.uriValidation = mode
+}
+
 func (a *Acceptor) Receive(data []byte) (payload []byte, welcomed bool, err error) {
+	if a.maxPayload > 0 && len(data) > a.maxPayload {
+		return nil, false, NewProtocolViolationError("message of %d bytes exceeds the maximum payload size of %d",
+			len(data), a.maxPayload)
+	}
+
 	msg, err := a.serializer.Deserialize(data)
 	if err != nil {
-		return nil, false, err
+		return nil, false, NewProtocolViolationError("failed to deserialize message: %w", err)
 	}
 
 	toSend, err := a.ReceiveMessage(msg)
@@ -97,15 +230,26 @@ func (a *Acceptor) Receive(data []byte) (payload []byte, welcomed bool, err erro
 
 func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error) {
 	if a.state == AcceptorStateWelcomeSent {
-		return nil, errors.New("session was established, not expecting any new messages")
+		return nil, NewProtocolViolationError("session was established, not expecting any new messages")
 	}
 
 	if msg.Type() == messages.MessageTypeHello {
 		if a.state != AcceptorStateNone {
-			return nil, fmt.Errorf("state must be %d when processing HELLO but was %d", AcceptorStateNone, a.state)
+			return nil, NewProtocolViolationError("state must be %d when processing HELLO but was %d",
+				AcceptorStateNone, a.state)
 		}
 
 		hello := msg.(*messages.Hello)
+		if err := ValidateURI(hello.Realm(), a.uriValidation, false); err != nil {
+			return messages.NewAbort(map[string]any{}, ErrInvalidURI, []any{err.Error()}, nil), nil
+		}
+
+		hello, err := a.resolveRealm(hello)
+		if err != nil {
+			a.logger.Debug("rejected HELLO for unknown realm", "realm", hello.Realm(), "error", err)
+			return messages.NewAbort(map[string]any{}, ErrNoSuchRealm, []any{err.Error()}, nil), nil
+		}
+
 		authMethod, err := auth.SelectAuthMethod(a.authenticator.Methods(), hello.AuthMethods())
 		if err != nil {
 			abort := messages.NewAbort(map[string]any{}, ErrAuthenticationFailed, []any{err.Error()}, nil)
@@ -124,8 +268,9 @@ func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error
 				return abort, nil
 			}
 
-			return a.sendWelcome(GenerateID(), response, nil), nil
+			return a.sendWelcome(a.idGen.NextID(), response, nil), nil
 		case auth.Ticket:
+			a.challengeAt = a.now()
 			a.state = AcceptorStateChallengeSent
 			return messages.NewChallenge(string(authMethod), map[string]any{}), nil
 		case auth.WAMPCRA:
@@ -141,7 +286,11 @@ func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error
 				return nil, errors.New("internal response for WAMPCRA auth was of invalid type")
 			}
 
-			chStr, err := auth.GenerateWAMPCRAChallenge(GenerateID(), response.AuthID(), response.AuthRole(), "dynamic")
+			// the session ID is part of the signed challenge, so the session gets the same ID
+			a.sessionID = a.idGen.NextID()
+			a.challengeAt = a.now()
+			chStr, err := auth.GenerateWAMPCRAChallengeAt(a.sessionID, response.AuthID(), response.AuthRole(),
+				a.responseAuthProvider(response), a.challengeAt)
 			if err != nil {
 				return nil, err
 			}
@@ -164,16 +313,23 @@ func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error
 		case auth.CryptoSign:
 			pKey, ok := hello.AuthExtra()["pubkey"]
 			if !ok {
-				return nil, fmt.Errorf("pubkey missing in authextra")
+				return nil, NewProtocolViolationError("pubkey missing in authextra")
 			}
 
 			publicKey, ok := pKey.(string)
 			if !ok {
-				return nil, fmt.Errorf("pubkey must be a string in authextra, was %T", publicKey)
+				return nil, NewProtocolViolationError("pubkey must be a string in authextra, was %T", publicKey)
 			}
 
 			if publicKey == "" {
-				return nil, fmt.Errorf("pubkey empty in authextra")
+				return nil, NewProtocolViolationError("pubkey empty in authextra")
+			}
+
+			bindingType, _ := hello.AuthExtra()["channel_binding"].(string)
+			if bindingType != "" && (a.binding == nil || a.binding.Type != bindingType) {
+				abort := messages.NewAbort(map[string]any{}, ErrAuthenticationFailed,
+					[]any{fmt.Sprintf("channel binding %s not available", bindingType)}, nil)
+				return abort, nil
 			}
 
 			request := auth.NewCryptoSignRequest(hello, publicKey)
@@ -192,15 +348,56 @@ func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error
 			}
 
 			a.challenge = chStr
+			a.challengeAt = a.now()
 			a.state = AcceptorStateChallengeSent
 
-			return messages.NewChallenge(string(authMethod), map[string]any{"challenge": chStr}), nil
+			extra := map[string]any{"challenge": chStr}
+			if bindingType != "" {
+				extra["channel_binding"] = bindingType
+			}
+
+			return messages.NewChallenge(string(authMethod), extra), nil
+		case auth.SCRAM:
+			nonce, _ := hello.AuthExtra()["nonce"].(string)
+			if nonce == "" {
+				return nil, NewProtocolViolationError("nonce missing in authextra")
+			}
+
+			request := auth.NewSCRAMRequest(hello, nonce)
+			response, err := a.authenticator.Authenticate(request)
+			if err != nil {
+				abort := messages.NewAbort(map[string]any{}, ErrAuthenticationFailed, []any{err.Error()}, nil)
+				return abort, nil
+			}
+
+			scramResponse, ok := response.(*auth.SCRAMResponse)
+			if !ok {
+				return nil, errors.New("internal response for SCRAM auth was of invalid type")
+			}
+
+			extra, err := auth.GenerateSCRAMChallenge(scramResponse.Credential(), nonce)
+			if err != nil {
+				return nil, err
+			}
+
+			a.challenge = extra["nonce"].(string)
+			a.request = request
+			a.response = response
+			a.challengeAt = a.now()
+			a.state = AcceptorStateChallengeSent
+
+			return messages.NewChallenge(string(authMethod), extra), nil
 		default:
 			return nil, fmt.Errorf("received HELLO for unexpected authmethod %s", authMethod)
 		}
 	} else if msg.Type() == messages.MessageTypeAuthenticate {
 		if a.state != AcceptorStateChallengeSent {
-			return nil, fmt.Errorf("received AUTHENTICATE while state was %d", a.state)
+			return nil, NewProtocolViolationError("received AUTHENTICATE while state was %d", a.state)
+		}
+
+		if a.challengeTTL > 0 && a.now().Sub(a.challengeAt) > a.challengeTTL {
+			abort := messages.NewAbort(map[string]any{}, ErrAuthenticationFailed, []any{"challenge expired"}, nil)
+			return abort, nil
 		}
 
 		switch a.authMethod {
@@ -213,7 +410,7 @@ func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error
 				return abort, nil
 			}
 
-			return a.sendWelcome(GenerateID(), response, authenticate.Extra()), nil
+			return a.sendWelcome(a.idGen.NextID(), response, authenticate.Extra()), nil
 		case auth.WAMPCRA:
 			authenticate := msg.(*messages.Authenticate)
 			response := a.response.(*auth.CRAResponse)
@@ -230,7 +427,7 @@ func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error
 				return abort, nil
 			}
 
-			return a.sendWelcome(GenerateID(), a.response, authenticate.Extra()), nil
+			return a.sendWelcome(a.sessionID, a.response, authenticate.Extra()), nil
 		case auth.CryptoSign:
 			authenticate := msg.(*messages.Authenticate)
 			request := a.request.(*auth.RequestCryptoSign)
@@ -239,37 +436,178 @@ func (a *Acceptor) ReceiveMessage(msg messages.Message) (messages.Message, error
 				return nil, fmt.Errorf("failed to decode public key")
 			}
 
-			verified, _ := auth.VerifyCryptoSignSignature(authenticate.Signature(), key)
+			var bindingData []byte
+			if bindingType, _ := request.AuthExtra()["channel_binding"].(string); bindingType != "" {
+				bindingData = a.binding.Data
+			}
+
+			verified, _ := auth.VerifyCryptoSignSignatureWithChannelBinding(authenticate.Signature(), a.challenge,
+				bindingData, key)
 			if !verified {
 				abort := messages.NewAbort(map[string]any{}, "wamp.error.authentication_failed", nil, nil)
 				return abort, nil
 			}
 
-			return a.sendWelcome(GenerateID(), a.response, authenticate.Extra()), nil
+			return a.sendWelcome(a.idGen.NextID(), a.response, authenticate.Extra()), nil
+		case auth.SCRAM:
+			authenticate := msg.(*messages.Authenticate)
+			request := a.request.(*auth.SCRAMRequest)
+			credential := a.response.(*auth.SCRAMResponse).Credential()
+
+			authMessage := auth.SCRAMAuthMessage(request.AuthID(), request.Nonce(), a.challenge, credential.Salt,
+				credential.Iterations, "")
+			serverSignature, err := auth.VerifySCRAMProof(credential, authMessage, authenticate.Signature())
+			if err != nil {
+				abort := messages.NewAbort(map[string]any{}, ErrAuthenticationFailed, nil, nil)
+				return abort, nil
+			}
+
+			// the client may verify the server with the server signature
+			welcomeExtra := map[string]any{"scram_server_signature": serverSignature}
+			for key, value := range responseAuthExtra(a.response) {
+				welcomeExtra[key] = value
+			}
+
+			response, err := auth.NewResponseWithExtra(a.response.AuthID(), a.response.AuthRole(),
+				a.responseAuthProvider(a.response), welcomeExtra, a.response.TTL())
+			if err != nil {
+				return nil, err
+			}
+
+			return a.sendWelcome(a.idGen.NextID(), response, authenticate.Extra()), nil
 		default:
-			return nil, fmt.Errorf("received AUTHENTICATE for unexpected authmethod %s", a.authMethod)
+			return nil, NewProtocolViolationError("received AUTHENTICATE for unexpected authmethod %s", a.authMethod)
 		}
 	} else {
-		return nil, fmt.Errorf("received unexpected message %T", msg)
+		return nil, NewProtocolViolationError("received unexpected message %T", msg)
+	}
+}
+
+// responseAuthProvider returns the authprovider of response, or the configured one if it
+// doesn't name any.
+func (a *Acceptor) responseAuthProvider(response auth.Response) string {
+	if response, ok := response.(auth.ResponseWithExtra); ok && response.AuthProvider() != "" {
+		return response.AuthProvider()
+	}
+
+	return a.authProvider
+}
+
+// responseAuthExtra returns the authextra of response, if it has any.
+func responseAuthExtra(response auth.Response) map[string]any {
+	if response, ok := response.(auth.ResponseWithExtra); ok {
+		return response.AuthExtra()
 	}
+
+	return nil
 }
 
 func (a *Acceptor) sendWelcome(sessionID uint64, response auth.Response, authExtra map[string]any) *messages.Welcome {
-	welcome := messages.NewWelcome(sessionID, map[string]any{
-		"realm":      a.hello.Realm(),
-		"roles":      RouterRoles,
-		"authid":     response.AuthID(),
-		"authrole":   response.AuthRole(),
-		"authmethod": a.authMethod,
-	})
+	roles := a.roles
+	if a.realmRoles != nil {
+		roles = a.realmRoles(a.hello.Realm())
+	}
+
+	authProvider := a.responseAuthProvider(response)
+	details := map[string]any{
+		"realm":        a.hello.Realm(),
+		"roles":        roles,
+		"authid":       response.AuthID(),
+		"authrole":     response.AuthRole(),
+		"authmethod":   a.authMethod,
+		"authprovider": authProvider,
+	}
+
+	responseExtra := responseAuthExtra(response)
+	if len(responseExtra) > 0 {
+		details["authextra"] = responseExtra
+	}
+
+	sessionID, resumeToken, resumed := a.resume(sessionID, response)
+	if resumeToken != "" {
+		details[OptionResumeToken] = resumeToken
+		details[OptionResumed] = resumed
+	}
+
+	welcome := messages.NewWelcome(sessionID, details)
 
 	a.sessionDetails = NewSessionDetails(sessionID, a.hello.Realm(), response.AuthID(), response.AuthRole(),
-		string(a.authMethod), a.serializer.Static(), RouterRoles, authExtra)
+		string(a.authMethod), a.serializer.Static(), roles, responseExtra)
+	// only the authenticator vouches for the session authextra, what the client sent is kept apart
+	a.sessionDetails.clientAuthExtra = authExtra
+	a.sessionDetails.authProvider = authProvider
+	a.sessionDetails.resumeToken = resumeToken
+	a.sessionDetails.resumed = resumed
+	a.sessionDetails.features = NegotiateFeatures(a.hello.Roles(), roles)
+	a.sessionDetails.createdAt = auth.ISO8601(a.now())
+	a.logger.Debug("session established", "session", sessionID, "realm", a.hello.Realm(),
+		"authid", response.AuthID(), "authrole", response.AuthRole(), "authmethod", a.authMethod)
 	a.state = AcceptorStateWelcomeSent
 
 	return welcome
 }
 
+// resolveRealm checks the realm of hello against the realm registry and returns hello for
+// the realm the client actually joins.
+func (a *Acceptor) resolveRealm(hello *messages.Hello) (*messages.Hello, error) {
+	if a.realms == nil {
+		return hello, nil
+	}
+
+	realm, exists := a.realms.ResolveRealm(hello.Realm())
+	if !exists {
+		creator, ok := a.realms.(RealmCreator)
+		if !a.autoCreate || !ok {
+			return hello, fmt.Errorf("no such realm %s", hello.Realm())
+		}
+
+		if err := creator.CreateRealm(hello.Realm()); err != nil {
+			return hello, fmt.Errorf("failed to create realm %s: %w", hello.Realm(), err)
+		}
+
+		a.logger.Info("created realm", "realm", hello.Realm())
+		realm = hello.Realm()
+	}
+
+	if realm == hello.Realm() {
+		return hello, nil
+	}
+
+	return messages.NewHello(realm, hello.AuthID(), hello.AuthExtra(), hello.Roles(), hello.AuthMethods()), nil
+}
+
+// resume looks up the session to resume if the client sent a resume token and issues a
+// new token if the client asked for one. A token only resumes a session of the same
+// authid and authrole, otherwise the client gets the freshly generated sessionID.
+func (a *Acceptor) resume(sessionID uint64, response auth.Response) (uint64, string, bool) {
+	if a.store == nil {
+		return sessionID, "", false
+	}
+
+	resumable, _ := a.hello.AuthExtra()[OptionResumable].(bool)
+	resumed := false
+	if token, _ := a.hello.AuthExtra()[OptionResumeToken].(string); token != "" {
+		previous, ok := a.store.Resume(a.hello.Realm(), token)
+		if ok && previous.AuthID() == response.AuthID() && previous.AuthRole() == response.AuthRole() {
+			sessionID = previous.ID()
+			resumed = true
+		}
+
+		resumable = true
+	}
+
+	if !resumable {
+		return sessionID, "", false
+	}
+
+	resumeToken, err := a.store.IssueToken(a.hello.Realm(), sessionID)
+	if err != nil {
+		return sessionID, "", false
+	}
+
+	return sessionID, resumeToken, resumed
+}
+
 func (a *Acceptor) SessionDetails() (*SessionDetails, error) {
 	if a.sessionDetails == nil {
 		return nil, fmt.Errorf("session is not setup yet")
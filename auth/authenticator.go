@@ -13,9 +13,10 @@ const (
 	Ticket     Method = "ticket"
 	WAMPCRA    Method = "wampcra"
 	CryptoSign Method = "cryptosign"
+	SCRAM      Method = "wamp-scram"
 )
 
-var Methods = []Method{Anonymous, Ticket, WAMPCRA, CryptoSign} // nolint:gochecknoglobals
+var Methods = []Method{Anonymous, Ticket, WAMPCRA, CryptoSign, SCRAM} // nolint:gochecknoglobals
 
 type ClientAuthenticator interface {
 	AuthMethod() string
@@ -24,6 +25,12 @@ type ClientAuthenticator interface {
 	Authenticate(challenge messages.Challenge) (*messages.Authenticate, error)
 }
 
+// WelcomeVerifier is implemented by client authenticators that authenticate the router
+// as well, the join fails if VerifyWelcome rejects the authextra of WELCOME.
+type WelcomeVerifier interface {
+	VerifyWelcome(authExtra map[string]any) error
+}
+
 type ServerAuthenticator interface {
 	Methods() []Method
 	Authenticate(request Request) (Response, error)
@@ -69,17 +76,28 @@ func (b *baseRequest) AuthExtra() map[string]any {
 }
 
 type baseResponse struct {
-	authID   string
-	authRole string
+	authID       string
+	authRole     string
+	authProvider string
+	authExtra    map[string]any
 
 	ttl time.Duration
 }
 
 func NewResponse(authID, authRole string, ttl time.Duration) (Response, error) {
+	return NewResponseWithExtra(authID, authRole, "", nil, ttl)
+}
+
+// NewResponseWithExtra returns a Response whose authprovider and authextra are sent to
+// the client in WELCOME, e.g. to hand out a tenant ID or a session token.
+func NewResponseWithExtra(authID, authRole, authProvider string, authExtra map[string]any,
+	ttl time.Duration) (ResponseWithExtra, error) {
 	return &baseResponse{
-		authID:   authID,
-		authRole: authRole,
-		ttl:      ttl,
+		authID:       authID,
+		authRole:     authRole,
+		authProvider: authProvider,
+		authExtra:    authExtra,
+		ttl:          ttl,
 	}, nil
 }
 
@@ -91,6 +109,14 @@ func (r *baseResponse) AuthRole() string {
 	return r.authRole
 }
 
+func (r *baseResponse) AuthProvider() string {
+	return r.authProvider
+}
+
+func (r *baseResponse) AuthExtra() map[string]any {
+	return r.authExtra
+}
+
 func (r *baseResponse) TTL() time.Duration {
 	return r.ttl
 }
@@ -98,10 +124,20 @@ func (r *baseResponse) TTL() time.Duration {
 type Response interface {
 	AuthID() string
 	AuthRole() string
-
 	TTL() time.Duration
 }
 
+// ResponseWithExtra is implemented by responses that have an authprovider or authextra
+// for WELCOME.
+type ResponseWithExtra interface {
+	Response
+
+	// AuthProvider is announced in WELCOME, an empty string announces the acceptor's default.
+	AuthProvider() string
+	// AuthExtra is sent to the client in WELCOME and may be nil.
+	AuthExtra() map[string]any
+}
+
 func NewCryptoSignRequest(hello *messages.Hello, publicKey string) Request {
 	return &RequestCryptoSign{
 		Request:   NewRequest(hello, CryptoSign),
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+const (
+	ChannelBindingTLSUnique   = "tls-unique"
+	ChannelBindingTLSExporter = "tls-exporter"
+
+	channelBindingLen = 32
+)
+
+// ChannelBinding identifies the secure channel a client authenticates over, so that a
+// signature can't be relayed to the router over another channel.
+type ChannelBinding struct {
+	Type string
+	// Data is the 32 bytes the challenge is XORed with before it is signed.
+	Data []byte
+}
+
+// TLSChannelBinding returns the channel binding of a TLS connection. tls-exporter (RFC
+// 9266) works with every TLS version, tls-unique only with TLS 1.2 and below and is
+// hashed with SHA-256 to the length of the challenge.
+func TLSChannelBinding(state tls.ConnectionState, bindingType string) (*ChannelBinding, error) {
+	switch bindingType {
+	case ChannelBindingTLSExporter:
+		data, err := state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, channelBindingLen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export keying material: %w", err)
+		}
+
+		return &ChannelBinding{Type: bindingType, Data: data}, nil
+	case ChannelBindingTLSUnique:
+		if len(state.TLSUnique) == 0 {
+			return nil, errors.New("tls-unique is not available for this connection")
+		}
+
+		data := sha256.Sum256(state.TLSUnique)
+		return &ChannelBinding{Type: bindingType, Data: data[:]}, nil
+	default:
+		return nil, fmt.Errorf("unsupported channel binding %q", bindingType)
+	}
+}
+
+// xorChannelBinding returns challenge XORed with the channel binding data.
+func xorChannelBinding(challenge, data []byte) ([]byte, error) {
+	if len(data) != len(challenge) {
+		return nil, fmt.Errorf("channel binding data must be %d bytes, was %d", len(challenge), len(data))
+	}
+
+	result := make([]byte, len(challenge))
+	for i := range challenge {
+		result[i] = challenge[i] ^ data[i]
+	}
+
+	return result, nil
+}
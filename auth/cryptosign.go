@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/hex"
@@ -18,20 +20,84 @@ type cryptoSignAuthenticator struct {
 	authID    string
 	authExtra map[string]any
 
+	signer         ChallengeSigner
+	channelBinding *ChannelBinding
+}
+
+// ChallengeSigner signs cryptosign challenges for a client, so that the private key can
+// be held elsewhere, like in an ssh-agent, an HSM or a TPM backed daemon.
+type ChallengeSigner interface {
+	PublicKey() ed25519.PublicKey
+	// Sign returns the Ed25519 signature of message, the raw challenge already XORed with
+	// the channel binding data if any.
+	Sign(message []byte) ([]byte, error)
+}
+
+type privateKeySigner struct {
 	privateKey ed25519.PrivateKey
 }
 
+func (s *privateKeySigner) PublicKey() ed25519.PublicKey {
+	return s.privateKey.Public().(ed25519.PublicKey)
+}
+
+func (s *privateKeySigner) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.privateKey, message), nil
+}
+
+type cryptoSigner struct {
+	signer    crypto.Signer
+	publicKey ed25519.PublicKey
+}
+
+// NewChallengeSigner returns a ChallengeSigner for a crypto.Signer of an Ed25519 key,
+// e.g. one returned by NewSSHAgentSigner.
+func NewChallengeSigner(signer crypto.Signer) (ChallengeSigner, error) {
+	if privateKey, ok := signer.(ed25519.PrivateKey); ok {
+		return &privateKeySigner{privateKey: privateKey}, nil
+	}
+
+	publicKey, ok := signer.Public().(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("signer must be for an ed25519 key, was %T", signer.Public())
+	}
+
+	return &cryptoSigner{signer: signer, publicKey: publicKey}, nil
+}
+
+func (s *cryptoSigner) PublicKey() ed25519.PublicKey {
+	return s.publicKey
+}
+
+func (s *cryptoSigner) Sign(message []byte) ([]byte, error) {
+	return s.signer.Sign(rand.Reader, message, crypto.Hash(0))
+}
+
 func NewCryptoSignAuthenticator(authID string, privateKeyHex string,
 	authExtra map[string]any) (ClientAuthenticator, error) {
 
 	privateKeyRaw, err := hex.DecodeString(privateKeyHex)
-	if err != nil {
+	if err != nil || len(privateKeyRaw) != ed25519.SeedSize {
 		return nil, errors.New("invalid private key")
 	}
 
-	privateKey := ed25519.NewKeyFromSeed(privateKeyRaw)
-	publicKey := privateKey.Public().(ed25519.PublicKey)
-	publicKeyHex := hex.EncodeToString(publicKey)
+	signer := &privateKeySigner{privateKey: ed25519.NewKeyFromSeed(privateKeyRaw)}
+	return NewCryptoSignAuthenticatorWithSigner(authID, signer, authExtra)
+}
+
+// NewCryptoSignAuthenticatorWithSigner returns a cryptosign authenticator that leaves
+// signing the challenge to signer.
+func NewCryptoSignAuthenticatorWithSigner(authID string, signer ChallengeSigner,
+	authExtra map[string]any) (ClientAuthenticator, error) {
+	if signer == nil {
+		return nil, errors.New("signer is required")
+	}
+
+	if len(signer.PublicKey()) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("signer public key must be %d bytes", ed25519.PublicKeySize)
+	}
+
+	publicKeyHex := hex.EncodeToString(signer.PublicKey())
 
 	if authExtra == nil {
 		authExtra = map[string]any{}
@@ -46,12 +112,34 @@ func NewCryptoSignAuthenticator(authID string, privateKeyHex string,
 	}
 
 	return &cryptoSignAuthenticator{
-		authID:     authID,
-		authExtra:  authExtra,
-		privateKey: privateKey,
+		authID:    authID,
+		authExtra: authExtra,
+		signer:    signer,
 	}, nil
 }
 
+// NewCryptoSignAuthenticatorWithChannelBinding returns a cryptosign authenticator that
+// asks the router to bind the signature to the channel, see TLSChannelBinding.
+func NewCryptoSignAuthenticatorWithChannelBinding(authID string, privateKeyHex string, authExtra map[string]any,
+	channelBinding *ChannelBinding) (ClientAuthenticator, error) {
+	authenticator, err := NewCryptoSignAuthenticator(authID, privateKeyHex, authExtra)
+	if err != nil {
+		return nil, err
+	}
+
+	if channelBinding != nil {
+		if len(channelBinding.Data) != channelBindingLen {
+			return nil, fmt.Errorf("channel binding data must be %d bytes", channelBindingLen)
+		}
+
+		a := authenticator.(*cryptoSignAuthenticator)
+		a.channelBinding = channelBinding
+		a.authExtra["channel_binding"] = channelBinding.Type
+	}
+
+	return authenticator, nil
+}
+
 func (a *cryptoSignAuthenticator) AuthMethod() string {
 	return MethodCryptoSign
 }
@@ -66,24 +154,66 @@ func (a *cryptoSignAuthenticator) AuthExtra() map[string]any {
 
 func (a *cryptoSignAuthenticator) Authenticate(challenge messages.Challenge) (*messages.Authenticate, error) {
 	challengeHex, _ := challenge.Extra()["challenge"].(string)
-	result, err := SignCryptoSignChallenge(challengeHex, a.privateKey)
+
+	var bindingData []byte
+	bindingType, _ := challenge.Extra()["channel_binding"].(string)
+	if a.channelBinding != nil {
+		// a router that doesn't confirm the binding might be relaying the challenge
+		if bindingType != a.channelBinding.Type {
+			return nil, fmt.Errorf("router did not bind the challenge to the %s channel", a.channelBinding.Type)
+		}
+
+		bindingData = a.channelBinding.Data
+	} else if bindingType != "" {
+		return nil, fmt.Errorf("router asked for %s channel binding, which is not available", bindingType)
+	}
+
+	message, err := cryptoSignMessage(challengeHex, bindingData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign challenge")
+		return nil, err
 	}
 
-	return messages.NewAuthenticate(result, a.AuthExtra()), nil
+	signature, err := a.signer.Sign(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign challenge: %w", err)
+	}
+
+	// a signer that signed something else would only fail at the router
+	if !ed25519.Verify(a.signer.PublicKey(), message, signature) {
+		return nil, errors.New("signer returned an invalid signature for the challenge")
+	}
+
+	return messages.NewAuthenticate(hex.EncodeToString(signature)+hex.EncodeToString(message), a.AuthExtra()), nil
 }
 
 func SignCryptoSignChallenge(challenge string, privateKey ed25519.PrivateKey) (string, error) {
-	challengeRaw, err := hex.DecodeString(challenge)
+	return SignCryptoSignChallengeWithChannelBinding(challenge, nil, privateKey)
+}
+
+// SignCryptoSignChallengeWithChannelBinding signs the challenge XORed with the channel
+// binding data. Without channel binding data the challenge is signed as it is.
+func SignCryptoSignChallengeWithChannelBinding(challenge string, channelBinding []byte,
+	privateKey ed25519.PrivateKey) (string, error) {
+	message, err := cryptoSignMessage(challenge, channelBinding)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode challenge: %w", err)
+		return "", err
 	}
 
-	signedRaw := ed25519.Sign(privateKey, challengeRaw)
-	signedHex := hex.EncodeToString(signedRaw)
+	return hex.EncodeToString(ed25519.Sign(privateKey, message)) + hex.EncodeToString(message), nil
+}
 
-	return signedHex + challenge, nil
+// cryptoSignMessage returns the message to sign for the hex encoded challenge.
+func cryptoSignMessage(challenge string, channelBinding []byte) ([]byte, error) {
+	message, err := hex.DecodeString(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode challenge: %w", err)
+	}
+
+	if channelBinding != nil {
+		return xorChannelBinding(message, channelBinding)
+	}
+
+	return message, nil
 }
 
 func VerifyCryptoSignSignature(signature string, publicKey []byte) (bool, error) {
@@ -104,6 +234,32 @@ func VerifyCryptoSignSignature(signature string, publicKey []byte) (bool, error)
 	return verify, nil
 }
 
+// VerifyCryptoSignSignatureWithChannelBinding verifies the signature and checks that the
+// signed message is the challenge XORed with the channel binding data, or the challenge
+// itself without channel binding data.
+func VerifyCryptoSignSignatureWithChannelBinding(signature, challenge string, channelBinding,
+	publicKey []byte) (bool, error) {
+	verified, err := VerifyCryptoSignSignature(signature, publicKey)
+	if err != nil || !verified {
+		return false, err
+	}
+
+	expected, err := hex.DecodeString(challenge)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode challenge: %w", err)
+	}
+
+	if channelBinding != nil {
+		if expected, err = xorChannelBinding(expected, channelBinding); err != nil {
+			return false, err
+		}
+	}
+
+	// VerifyCryptoSignSignature checked that signature is valid hex of the right length
+	signed, _ := hex.DecodeString(signature)
+	return bytes.Equal(signed[ed25519.SignatureSize:], expected), nil
+}
+
 func GenerateCryptoSignChallenge() (string, error) {
 	challenge := make([]byte, 32)
 	_, err := rand.Read(challenge)
@@ -0,0 +1,702 @@
+package auth
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/xconnio/wampproto-go/util"
+)
+
+const (
+	// AuthExtraCertificates and AuthExtraTrustRoot are the authextra keys a client
+	// presents its certificate chain with.
+	AuthExtraCertificates = "certificates"
+	AuthExtraTrustRoot    = "trustroot"
+
+	eip712DomainName    = "WMP"
+	eip712DomainVersion = "1"
+
+	delegateCertificateType  = "EIP712DelegateCertificate"
+	authorityCertificateType = "EIP712AuthorityCertificate"
+
+	ethereumAddressLen   = 20
+	ethereumSignatureLen = 65
+)
+
+// Capabilities of authority certificates.
+const (
+	CryptoSignCapabilityRootCA uint64 = 1 << iota
+	CryptoSignCapabilityIntermediateCA
+	CryptoSignCapabilityPublicRelay
+	CryptoSignCapabilityPrivateRelay
+	CryptoSignCapabilityProvider
+	CryptoSignCapabilityConsumer
+)
+
+type eip712Field struct {
+	name string
+	kind string
+}
+
+var (
+	eip712DomainFields = []eip712Field{ //nolint:gochecknoglobals
+		{"name", "string"},
+		{"version", "string"},
+	}
+
+	delegateCertificateFields = []eip712Field{ //nolint:gochecknoglobals
+		{"chainId", "uint256"},
+		{"verifyingContract", "address"},
+		{"validFrom", "uint256"},
+		{"delegate", "address"},
+		{"csPubKey", "bytes32"},
+		{"bootedAt", "uint64"},
+		{"meta", "string"},
+	}
+
+	authorityCertificateFields = []eip712Field{ //nolint:gochecknoglobals
+		{"chainId", "uint256"},
+		{"verifyingContract", "address"},
+		{"validFrom", "uint256"},
+		{"issuer", "address"},
+		{"subject", "address"},
+		{"realm", "address"},
+		{"capabilities", "uint64"},
+		{"meta", "string"},
+	}
+)
+
+// CryptoSignDelegateCertificate is the EIP712DelegateCertificate of WAMP-Cryptosign. It
+// binds the Ed25519 key of a client to the Ethereum address of the delegate signing it.
+type CryptoSignDelegateCertificate struct {
+	ChainID           uint64
+	VerifyingContract string
+	// ValidFrom is a block number, the router has no access to the chain and doesn't
+	// check it.
+	ValidFrom uint64
+	Delegate  string
+	// CSPubKey is the hex encoded Ed25519 public key of the client.
+	CSPubKey string
+	// BootedAt is when the delegate booted, in nanoseconds since the epoch. JSON carries
+	// integers as doubles, so values above 2^53 only survive CBOR and MessagePack.
+	BootedAt uint64
+	Meta     string
+	// Signature is the hex encoded Ethereum signature of the delegate.
+	Signature string
+}
+
+func (c *CryptoSignDelegateCertificate) values() []any {
+	return []any{c.ChainID, c.VerifyingContract, c.ValidFrom, c.Delegate, c.CSPubKey, c.BootedAt, c.Meta}
+}
+
+// Sign sets the delegate of the certificate to the address of the secp256k1 privateKey
+// and signs it.
+func (c *CryptoSignDelegateCertificate) Sign(privateKey []byte) error {
+	address, err := EthereumAddress(privateKey)
+	if err != nil {
+		return err
+	}
+
+	c.Delegate = address
+	c.Signature, err = signEIP712(privateKey, delegateCertificateType, delegateCertificateFields, c.values())
+	return err
+}
+
+// Signer returns the address of the key that signed the certificate.
+func (c *CryptoSignDelegateCertificate) Signer() (string, error) {
+	return recoverEIP712Signer(c.Signature, delegateCertificateType, delegateCertificateFields, c.values())
+}
+
+// TypedData returns the EIP-712 typed data of the certificate.
+func (c *CryptoSignDelegateCertificate) TypedData() map[string]any {
+	return eip712TypedData(delegateCertificateType, delegateCertificateFields, c.values())
+}
+
+// CryptoSignAuthorityCertificate is the EIP712AuthorityCertificate of WAMP-Cryptosign. The
+// issuer grants the subject the capabilities on the realm, a root certificate is issued
+// by its subject.
+type CryptoSignAuthorityCertificate struct {
+	ChainID           uint64
+	VerifyingContract string
+	// ValidFrom is a block number, the router has no access to the chain and doesn't
+	// check it.
+	ValidFrom    uint64
+	Issuer       string
+	Subject      string
+	Realm        string
+	Capabilities uint64
+	Meta         string
+	// Signature is the hex encoded Ethereum signature of the issuer.
+	Signature string
+}
+
+func (c *CryptoSignAuthorityCertificate) values() []any {
+	return []any{c.ChainID, c.VerifyingContract, c.ValidFrom, c.Issuer, c.Subject, c.Realm, c.Capabilities, c.Meta}
+}
+
+// Sign sets the issuer of the certificate to the address of the secp256k1 privateKey and
+// signs it.
+func (c *CryptoSignAuthorityCertificate) Sign(privateKey []byte) error {
+	address, err := EthereumAddress(privateKey)
+	if err != nil {
+		return err
+	}
+
+	c.Issuer = address
+	c.Signature, err = signEIP712(privateKey, authorityCertificateType, authorityCertificateFields, c.values())
+	return err
+}
+
+// Signer returns the address of the key that signed the certificate.
+func (c *CryptoSignAuthorityCertificate) Signer() (string, error) {
+	return recoverEIP712Signer(c.Signature, authorityCertificateType, authorityCertificateFields, c.values())
+}
+
+// TypedData returns the EIP-712 typed data of the certificate.
+func (c *CryptoSignAuthorityCertificate) TypedData() map[string]any {
+	return eip712TypedData(authorityCertificateType, authorityCertificateFields, c.values())
+}
+
+// CryptoSignCertificateChain is the certificate chain a client authenticates with.
+type CryptoSignCertificateChain struct {
+	Delegate *CryptoSignDelegateCertificate
+	// Authorities lead from the certificate of the delegate address up to the self-signed
+	// root certificate.
+	Authorities []*CryptoSignAuthorityCertificate
+}
+
+// CryptoSignCertificatesExtra returns the authextra a client presents chain with. Each
+// certificate is sent as a pair of its EIP-712 typed data and its signature.
+func CryptoSignCertificatesExtra(chain *CryptoSignCertificateChain, trustRoot string) map[string]any {
+	certificates := []any{[]any{chain.Delegate.TypedData(), chain.Delegate.Signature}}
+	for _, authority := range chain.Authorities {
+		certificates = append(certificates, []any{authority.TypedData(), authority.Signature})
+	}
+
+	extra := map[string]any{AuthExtraCertificates: certificates}
+	if trustRoot != "" {
+		extra[AuthExtraTrustRoot] = trustRoot
+	}
+
+	return extra
+}
+
+// ParseCryptoSignCertificates parses the AuthExtraCertificates authextra, after it went
+// through a serializer.
+func ParseCryptoSignCertificates(value any) (*CryptoSignCertificateChain, error) {
+	list, ok := value.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("certificates must be a non-empty list, was %T", value)
+	}
+
+	chain := &CryptoSignCertificateChain{}
+	for i, entry := range list {
+		message, signature, err := parseCertificateEntry(entry, i == 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			chain.Delegate, err = parseDelegateCertificate(message, signature)
+		} else {
+			var authority *CryptoSignAuthorityCertificate
+			authority, err = parseAuthorityCertificate(message, signature)
+			chain.Authorities = append(chain.Authorities, authority)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return chain, nil
+}
+
+// parseCertificateEntry returns the message and the signature of a [typed data, signature]
+// pair, the first certificate of a chain is the delegate certificate.
+func parseCertificateEntry(entry any, delegate bool) (map[string]any, string, error) {
+	pair, ok := entry.([]any)
+	if !ok || len(pair) != 2 {
+		return nil, "", errors.New("certificate must be a pair of typed data and signature")
+	}
+
+	typedData, ok := pair[0].(map[string]any)
+	if !ok {
+		return nil, "", fmt.Errorf("certificate typed data must be a dict, was %T", pair[0])
+	}
+
+	signature, ok := pair[1].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("certificate signature must be a string, was %T", pair[1])
+	}
+
+	expectedType := authorityCertificateType
+	if delegate {
+		expectedType = delegateCertificateType
+	}
+
+	if primaryType, _ := typedData["primaryType"].(string); primaryType != expectedType {
+		return nil, "", fmt.Errorf("expected %s, got %q", expectedType, primaryType)
+	}
+
+	message, ok := typedData["message"].(map[string]any)
+	if !ok {
+		return nil, "", fmt.Errorf("certificate message must be a dict, was %T", typedData["message"])
+	}
+
+	return message, signature, nil
+}
+
+func parseDelegateCertificate(message map[string]any, signature string) (*CryptoSignDelegateCertificate, error) {
+	certificate := &CryptoSignDelegateCertificate{Signature: signature}
+	if err := parseEIP712Message(message, delegateCertificateFields, []any{&certificate.ChainID,
+		&certificate.VerifyingContract, &certificate.ValidFrom, &certificate.Delegate, &certificate.CSPubKey,
+		&certificate.BootedAt, &certificate.Meta}); err != nil {
+		return nil, err
+	}
+
+	return certificate, nil
+}
+
+func parseAuthorityCertificate(message map[string]any, signature string) (*CryptoSignAuthorityCertificate, error) {
+	certificate := &CryptoSignAuthorityCertificate{Signature: signature}
+	if err := parseEIP712Message(message, authorityCertificateFields, []any{&certificate.ChainID,
+		&certificate.VerifyingContract, &certificate.ValidFrom, &certificate.Issuer, &certificate.Subject,
+		&certificate.Realm, &certificate.Capabilities, &certificate.Meta}); err != nil {
+		return nil, err
+	}
+
+	return certificate, nil
+}
+
+// CryptoSignCertificateClaims is what a verified certificate chain vouches for, addresses
+// are 0x prefixed lowercase hex.
+type CryptoSignCertificateClaims struct {
+	TrustRoot    string
+	Realm        string
+	Delegate     string
+	Capabilities uint64
+}
+
+// VerifyCryptoSignCertificateChain checks that chain binds publicKey to a delegate
+// certified by one of trustRoots and returns the claims of the chain. Each authority
+// certificate has to be issued by the subject of the next one, which needs a CA
+// capability and may only grant a subset of its own capabilities. All certificates have
+// to be for the same chain, contract and realm.
+func VerifyCryptoSignCertificateChain(publicKey string, chain *CryptoSignCertificateChain,
+	trustRoots []string) (*CryptoSignCertificateClaims, error) {
+	if chain == nil || chain.Delegate == nil || len(chain.Authorities) == 0 {
+		return nil, errors.New("certificate chain needs a delegate and at least one authority certificate")
+	}
+
+	delegate := chain.Delegate
+	if !strings.EqualFold(delegate.CSPubKey, publicKey) {
+		return nil, errors.New("delegate certificate is not for the key of the client")
+	}
+
+	if err := checkSigner(delegate.Signer, delegate.Delegate); err != nil {
+		return nil, fmt.Errorf("delegate certificate: %w", err)
+	}
+
+	subject := delegate.Delegate
+	realm := chain.Authorities[0].Realm
+	for i, certificate := range chain.Authorities {
+		if certificate.ChainID != delegate.ChainID || !sameAddress(certificate.VerifyingContract,
+			delegate.VerifyingContract) {
+			return nil, fmt.Errorf("certificate of %s is for another chain or contract", certificate.Subject)
+		}
+
+		if !sameAddress(certificate.Subject, subject) {
+			return nil, fmt.Errorf("certificate of %s does not certify %s", certificate.Subject, subject)
+		}
+
+		if !sameAddress(certificate.Realm, realm) {
+			return nil, fmt.Errorf("certificate of %s is for another realm", certificate.Subject)
+		}
+
+		if err := checkSigner(certificate.Signer, certificate.Issuer); err != nil {
+			return nil, fmt.Errorf("certificate of %s: %w", certificate.Subject, err)
+		}
+
+		if i+1 < len(chain.Authorities) {
+			parent := chain.Authorities[i+1]
+			if parent.Capabilities&(CryptoSignCapabilityRootCA|CryptoSignCapabilityIntermediateCA) == 0 {
+				return nil, fmt.Errorf("certificate of %s does not allow issuing certificates", parent.Subject)
+			}
+
+			if certificate.Capabilities&^parent.Capabilities != 0 {
+				return nil, fmt.Errorf("certificate of %s widens the capabilities", certificate.Subject)
+			}
+		}
+
+		subject = certificate.Issuer
+	}
+
+	root := chain.Authorities[len(chain.Authorities)-1]
+	if !sameAddress(root.Issuer, root.Subject) || root.Capabilities&CryptoSignCapabilityRootCA == 0 {
+		return nil, errors.New("certificate chain does not end in a root certificate")
+	}
+
+	if !slices.ContainsFunc(trustRoots, func(trustRoot string) bool { return sameAddress(trustRoot, root.Issuer) }) {
+		return nil, errors.New("certificate chain does not lead to a trust root")
+	}
+
+	return &CryptoSignCertificateClaims{
+		TrustRoot:    strings.ToLower(root.Issuer),
+		Realm:        strings.ToLower(realm),
+		Delegate:     strings.ToLower(delegate.Delegate),
+		Capabilities: chain.Authorities[0].Capabilities,
+	}, nil
+}
+
+// CryptoSignCertificateOptions configures the authenticator returned by
+// NewCryptoSignCertificateAuthenticator.
+type CryptoSignCertificateOptions struct {
+	// TrustRoots are the Ethereum addresses of the root certificates chains have to end in.
+	TrustRoots []string
+	// Realms maps the realm addresses of certificates to the realms they are valid for. A
+	// certificate for an address missing from it is only valid for the realm named by the
+	// address itself.
+	Realms map[string]string
+	// AuthRole is the authrole of the sessions, certificates don't carry one. Required.
+	AuthRole string
+	// Fallback, if set, authenticates cryptosign clients that don't present certificates.
+	Fallback ServerAuthenticator
+}
+
+type cryptoSignCertificateAuthenticator struct {
+	options CryptoSignCertificateOptions
+}
+
+// NewCryptoSignCertificateAuthenticator returns a ServerAuthenticator for cryptosign that
+// accepts any key with a WAMP-Cryptosign certificate chain from one of the trust roots.
+// The authid is the delegate address and has to match the authid from HELLO if the client
+// sent one. The key itself is verified by the Acceptor as usual.
+func NewCryptoSignCertificateAuthenticator(options CryptoSignCertificateOptions) (ServerAuthenticator, error) {
+	if len(options.TrustRoots) == 0 {
+		return nil, errors.New("at least one trust root is required")
+	}
+
+	for _, root := range options.TrustRoots {
+		if _, err := decodeAddress(root); err != nil {
+			return nil, fmt.Errorf("invalid trust root %q: %w", root, err)
+		}
+	}
+
+	if options.AuthRole == "" {
+		return nil, errors.New("authrole is required")
+	}
+
+	realms := make(map[string]string, len(options.Realms))
+	for address, realm := range options.Realms {
+		if _, err := decodeAddress(address); err != nil {
+			return nil, fmt.Errorf("invalid realm address %q: %w", address, err)
+		}
+
+		realms[strings.ToLower(address)] = realm
+	}
+	options.Realms = realms
+
+	return &cryptoSignCertificateAuthenticator{options: options}, nil
+}
+
+func (a *cryptoSignCertificateAuthenticator) Methods() []Method {
+	return []Method{CryptoSign}
+}
+
+func (a *cryptoSignCertificateAuthenticator) Authenticate(request Request) (Response, error) {
+	cryptoSignRequest, ok := request.(*RequestCryptoSign)
+	if !ok {
+		return nil, fmt.Errorf("certificate authenticator cannot handle %s requests", request.AuthMethod())
+	}
+
+	certificatesExtra, exists := request.AuthExtra()[AuthExtraCertificates]
+	if !exists {
+		if a.options.Fallback != nil {
+			return a.options.Fallback.Authenticate(request)
+		}
+
+		return nil, errors.New("certificates missing in authextra")
+	}
+
+	chain, err := ParseCryptoSignCertificates(certificatesExtra)
+	if err != nil {
+		return nil, err
+	}
+
+	trustRoots := a.options.TrustRoots
+	if trustRoot, _ := request.AuthExtra()[AuthExtraTrustRoot].(string); trustRoot != "" {
+		if !slices.ContainsFunc(trustRoots, func(root string) bool { return sameAddress(root, trustRoot) }) {
+			return nil, fmt.Errorf("unknown trust root %q", trustRoot)
+		}
+
+		trustRoots = []string{trustRoot}
+	}
+
+	claims, err := VerifyCryptoSignCertificateChain(cryptoSignRequest.PublicKey(), chain, trustRoots)
+	if err != nil {
+		return nil, err
+	}
+
+	realm, exists := a.options.Realms[claims.Realm]
+	if !exists {
+		realm = claims.Realm
+	}
+
+	if !strings.EqualFold(realm, request.Realm()) {
+		return nil, fmt.Errorf("certificate is not valid for realm %q", request.Realm())
+	}
+
+	if request.AuthID() != "" && !sameAddress(request.AuthID(), claims.Delegate) {
+		return nil, fmt.Errorf("certificate was issued for %q, not %q", claims.Delegate, request.AuthID())
+	}
+
+	return NewResponseWithExtra(claims.Delegate, a.options.AuthRole, "certificate",
+		map[string]any{AuthExtraTrustRoot: claims.TrustRoot}, 0)
+}
+
+// EthereumAddress returns the 0x prefixed lowercase hex address of the secp256k1
+// privateKey.
+func EthereumAddress(privateKey []byte) (string, error) {
+	key, err := secp256k1Key(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return publicKeyAddress(key.PubKey()), nil
+}
+
+func secp256k1Key(privateKey []byte) (*secp256k1.PrivateKey, error) {
+	if len(privateKey) != secp256k1.PrivKeyBytesLen {
+		return nil, fmt.Errorf("secp256k1 private key must be %d bytes", secp256k1.PrivKeyBytesLen)
+	}
+
+	key := secp256k1.PrivKeyFromBytes(privateKey)
+	if key.Key.IsZero() {
+		return nil, errors.New("invalid secp256k1 private key")
+	}
+
+	return key, nil
+}
+
+func publicKeyAddress(publicKey *secp256k1.PublicKey) string {
+	// the address is the tail of the hash of the uncompressed key without its prefix byte
+	hash := keccak256(publicKey.SerializeUncompressed()[1:])
+	return "0x" + hex.EncodeToString(hash[len(hash)-ethereumAddressLen:])
+}
+
+func checkSigner(signer func() (string, error), expected string) error {
+	address, err := signer()
+	if err != nil {
+		return err
+	}
+
+	if !sameAddress(address, expected) {
+		return fmt.Errorf("signed by %s instead of %s", address, expected)
+	}
+
+	return nil
+}
+
+func sameAddress(a, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "0x"), strings.TrimPrefix(b, "0x"))
+}
+
+func decodeHex(value string, size int) ([]byte, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != size {
+		return nil, fmt.Errorf("must be %d bytes, was %d", size, len(data))
+	}
+
+	return data, nil
+}
+
+func decodeAddress(address string) ([]byte, error) {
+	return decodeHex(address, ethereumAddressLen)
+}
+
+func keccak256(data ...[]byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	for _, chunk := range data {
+		hash.Write(chunk)
+	}
+
+	return hash.Sum(nil)
+}
+
+// eip712Digest returns the hash an EIP-712 signature signs for the struct of fields with
+// values in the WAMP-Cryptosign domain.
+func eip712Digest(primaryType string, fields []eip712Field, values []any) ([]byte, error) {
+	domainSeparator, err := eip712HashStruct("EIP712Domain", eip712DomainFields,
+		[]any{eip712DomainName, eip712DomainVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	structHash, err := eip712HashStruct(primaryType, fields, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return keccak256([]byte{0x19, 0x01}, domainSeparator, structHash), nil
+}
+
+func eip712HashStruct(primaryType string, fields []eip712Field, values []any) ([]byte, error) {
+	members := make([]string, len(fields))
+	for i, field := range fields {
+		members[i] = field.kind + " " + field.name
+	}
+
+	encoded := keccak256([]byte(primaryType + "(" + strings.Join(members, ",") + ")"))
+	for i, field := range fields {
+		word, err := eip712Word(field.kind, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", primaryType, field.name, err)
+		}
+
+		encoded = append(encoded, word...)
+	}
+
+	return keccak256(encoded), nil
+}
+
+// eip712Word returns the 32 byte encoding of an atomic value, strings are hashed.
+func eip712Word(kind string, value any) ([]byte, error) {
+	word := make([]byte, 32)
+	switch kind {
+	case "uint256", "uint64":
+		binary.BigEndian.PutUint64(word[24:], value.(uint64))
+	case "address":
+		address, err := decodeAddress(value.(string))
+		if err != nil {
+			return nil, err
+		}
+
+		copy(word[32-ethereumAddressLen:], address)
+	case "bytes32":
+		data, err := decodeHex(value.(string), 32)
+		if err != nil {
+			return nil, err
+		}
+
+		copy(word, data)
+	case "string":
+		return keccak256([]byte(value.(string))), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", kind)
+	}
+
+	return word, nil
+}
+
+func eip712TypedData(primaryType string, fields []eip712Field, values []any) map[string]any {
+	typeFields := func(fields []eip712Field) []any {
+		result := make([]any, len(fields))
+		for i, field := range fields {
+			result[i] = map[string]any{"name": field.name, "type": field.kind}
+		}
+
+		return result
+	}
+
+	message := make(map[string]any, len(fields))
+	for i, field := range fields {
+		message[field.name] = values[i]
+	}
+
+	return map[string]any{
+		"types": map[string]any{
+			"EIP712Domain": typeFields(eip712DomainFields),
+			primaryType:    typeFields(fields),
+		},
+		"primaryType": primaryType,
+		"domain":      map[string]any{"name": eip712DomainName, "version": eip712DomainVersion},
+		"message":     message,
+	}
+}
+
+// parseEIP712Message stores the members of message in targets, *uint64 for integers and
+// *string for everything else.
+func parseEIP712Message(message map[string]any, fields []eip712Field, targets []any) error {
+	for i, field := range fields {
+		value, exists := message[field.name]
+		if !exists {
+			return fmt.Errorf("certificate lacks %s", field.name)
+		}
+
+		switch target := targets[i].(type) {
+		case *uint64:
+			number, ok := util.AsUInt64(value)
+			if !ok {
+				return fmt.Errorf("certificate %s must be an integer, was %T", field.name, value)
+			}
+
+			*target = number
+		case *string:
+			str, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("certificate %s must be a string, was %T", field.name, value)
+			}
+
+			*target = str
+		}
+	}
+
+	return nil
+}
+
+func signEIP712(privateKey []byte, primaryType string, fields []eip712Field, values []any) (string, error) {
+	key, err := secp256k1Key(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := eip712Digest(primaryType, fields, values)
+	if err != nil {
+		return "", err
+	}
+
+	// the compact signature is v || r || s, Ethereum puts v last
+	compact := ecdsa.SignCompact(key, digest, false)
+	return hex.EncodeToString(append(compact[1:], compact[0])), nil
+}
+
+func recoverEIP712Signer(signature, primaryType string, fields []eip712Field, values []any) (string, error) {
+	data, err := decodeHex(signature, ethereumSignatureLen)
+	if err != nil {
+		return "", fmt.Errorf("invalid signature: %w", err)
+	}
+
+	recovery := data[ethereumSignatureLen-1]
+	if recovery < 27 {
+		recovery += 27
+	}
+
+	if recovery != 27 && recovery != 28 {
+		return "", fmt.Errorf("invalid signature recovery id %d", recovery)
+	}
+
+	digest, err := eip712Digest(primaryType, fields, values)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey, _, err := ecdsa.RecoverCompact(append([]byte{recovery}, data[:ethereumSignatureLen-1]...), digest)
+	if err != nil {
+		return "", fmt.Errorf("invalid signature: %w", err)
+	}
+
+	return publicKeyAddress(publicKey), nil
+}
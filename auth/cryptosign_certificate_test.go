@@ -0,0 +1,189 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+)
+
+const (
+	testChainID           = 1
+	testVerifyingContract = "0xf766dc789cf04cd18ae75af2c5fac2da6650c1b3"
+	testRealmAddress      = "0x163d58ce482560b7826b4612f40aa2a7d53310c4"
+)
+
+type ethereumKey struct {
+	address string
+	private []byte
+}
+
+func newEthereumKey(t *testing.T) ethereumKey {
+	privateKey := make([]byte, 32)
+	_, err := rand.Read(privateKey)
+	require.NoError(t, err)
+
+	address, err := auth.EthereumAddress(privateKey)
+	require.NoError(t, err)
+	return ethereumKey{address: address, private: privateKey}
+}
+
+func certify(t *testing.T, issuer, subject ethereumKey, capabilities uint64) *auth.CryptoSignAuthorityCertificate {
+	certificate := &auth.CryptoSignAuthorityCertificate{
+		ChainID:           testChainID,
+		VerifyingContract: testVerifyingContract,
+		Subject:           subject.address,
+		Realm:             testRealmAddress,
+		Capabilities:      capabilities,
+	}
+	require.NoError(t, certificate.Sign(issuer.private))
+	return certificate
+}
+
+func delegate(t *testing.T, key ethereumKey, publicKey string) *auth.CryptoSignDelegateCertificate {
+	certificate := &auth.CryptoSignDelegateCertificate{
+		ChainID:           testChainID,
+		VerifyingContract: testVerifyingContract,
+		CSPubKey:          publicKey,
+		BootedAt:          1700000000000000000,
+	}
+	require.NoError(t, certificate.Sign(key.private))
+	return certificate
+}
+
+func TestEthereumAddress(t *testing.T) {
+	// the signer of the example in EIP-712
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte("cow"))
+
+	address, err := auth.EthereumAddress(hash.Sum(nil))
+	require.NoError(t, err)
+	require.Equal(t, "0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826", address)
+
+	_, err = auth.EthereumAddress(make([]byte, 32))
+	require.Error(t, err)
+}
+
+func TestVerifyCryptoSignCertificateChain(t *testing.T) {
+	root, intermediate, device := newEthereumKey(t), newEthereumKey(t), newEthereumKey(t)
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	clientKey := hex.EncodeToString(publicKey)
+
+	chain := &auth.CryptoSignCertificateChain{
+		Delegate: delegate(t, device, clientKey),
+		Authorities: []*auth.CryptoSignAuthorityCertificate{
+			certify(t, intermediate, device, auth.CryptoSignCapabilityConsumer),
+			certify(t, root, intermediate, auth.CryptoSignCapabilityIntermediateCA|auth.CryptoSignCapabilityConsumer),
+			certify(t, root, root, auth.CryptoSignCapabilityRootCA|auth.CryptoSignCapabilityIntermediateCA|
+				auth.CryptoSignCapabilityConsumer),
+		},
+	}
+	roots := []string{root.address}
+
+	claims, err := auth.VerifyCryptoSignCertificateChain(clientKey, chain, roots)
+	require.NoError(t, err)
+	require.Equal(t, root.address, claims.TrustRoot)
+	require.Equal(t, testRealmAddress, claims.Realm)
+	require.Equal(t, device.address, claims.Delegate)
+	require.Equal(t, auth.CryptoSignCapabilityConsumer, claims.Capabilities)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		extra := auth.CryptoSignCertificatesExtra(chain, root.address)
+		parsed, err := auth.ParseCryptoSignCertificates(extra[auth.AuthExtraCertificates])
+		require.NoError(t, err)
+		require.Equal(t, chain, parsed)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		tampered := *chain.Delegate
+		tampered.Meta = "admin"
+		widened := certify(t, intermediate, device, auth.CryptoSignCapabilityConsumer|auth.CryptoSignCapabilityProvider)
+		notCA := certify(t, root, intermediate, auth.CryptoSignCapabilityConsumer)
+		selfSigned := certify(t, device, device, auth.CryptoSignCapabilityRootCA)
+
+		for name, testCase := range map[string]*auth.CryptoSignCertificateChain{
+			"Tampered": {Delegate: &tampered, Authorities: chain.Authorities},
+			"Widened": {Delegate: chain.Delegate, Authorities: []*auth.CryptoSignAuthorityCertificate{
+				widened, chain.Authorities[1], chain.Authorities[2]}},
+			"IssuerNotCA": {Delegate: chain.Delegate, Authorities: []*auth.CryptoSignAuthorityCertificate{
+				chain.Authorities[0], notCA, chain.Authorities[2]}},
+			"NoRoot":        {Delegate: chain.Delegate, Authorities: chain.Authorities[:2]},
+			"SelfCertified": {Delegate: chain.Delegate, Authorities: []*auth.CryptoSignAuthorityCertificate{selfSigned}},
+			"NoAuthorities": {Delegate: chain.Delegate},
+		} {
+			_, err := auth.VerifyCryptoSignCertificateChain(clientKey, testCase, roots)
+			require.Error(t, err, name)
+		}
+
+		_, err := auth.VerifyCryptoSignCertificateChain(hex.EncodeToString(make([]byte, 32)), chain, roots)
+		require.Error(t, err)
+
+		_, err = auth.VerifyCryptoSignCertificateChain(clientKey, chain, []string{intermediate.address})
+		require.Error(t, err)
+	})
+}
+
+func TestCryptoSignCertificateAuthenticator(t *testing.T) {
+	root, device := newEthereumKey(t), newEthereumKey(t)
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	clientKey := hex.EncodeToString(publicKey)
+
+	chain := &auth.CryptoSignCertificateChain{
+		Delegate: delegate(t, device, clientKey),
+		Authorities: []*auth.CryptoSignAuthorityCertificate{
+			certify(t, root, device, auth.CryptoSignCapabilityConsumer),
+			certify(t, root, root, auth.CryptoSignCapabilityRootCA|auth.CryptoSignCapabilityConsumer),
+		},
+	}
+	extra := auth.CryptoSignCertificatesExtra(chain, "")
+
+	_, err = auth.NewCryptoSignCertificateAuthenticator(auth.CryptoSignCertificateOptions{})
+	require.Error(t, err)
+
+	// certificates carry no authrole, so it has to be configured
+	_, err = auth.NewCryptoSignCertificateAuthenticator(auth.CryptoSignCertificateOptions{
+		TrustRoots: []string{root.address},
+	})
+	require.Error(t, err)
+
+	authenticator, err := auth.NewCryptoSignCertificateAuthenticator(auth.CryptoSignCertificateOptions{
+		TrustRoots: []string{root.address},
+		Realms:     map[string]string{testRealmAddress: "realm1"},
+		AuthRole:   "device",
+	})
+	require.NoError(t, err)
+
+	request := func(realm, authID string, extra map[string]any) auth.Request {
+		hello := messages.NewHello(realm, authID, extra, nil, []string{auth.MethodCryptoSign})
+		return auth.NewCryptoSignRequest(hello, clientKey)
+	}
+
+	response, err := authenticator.Authenticate(request("realm1", "", extra))
+	require.NoError(t, err)
+	require.Equal(t, device.address, response.AuthID())
+	require.Equal(t, "device", response.AuthRole())
+	require.Equal(t, "certificate", response.(auth.ResponseWithExtra).AuthProvider())
+
+	_, err = authenticator.Authenticate(request("realm1", device.address, extra))
+	require.NoError(t, err)
+
+	_, err = authenticator.Authenticate(request("realm2", "", extra))
+	require.Error(t, err)
+
+	_, err = authenticator.Authenticate(request("realm1", "device-2", extra))
+	require.Error(t, err)
+
+	_, err = authenticator.Authenticate(request("realm1", "", auth.CryptoSignCertificatesExtra(chain, device.address)))
+	require.Error(t, err)
+
+	_, err = authenticator.Authenticate(request("realm1", "", map[string]any{}))
+	require.Error(t, err)
+}
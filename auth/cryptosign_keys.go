@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	pemTypeEncryptedSeed = "ENCRYPTED CRYPTOSIGN SEED"
+
+	// argon2id parameters of encrypted seeds, the second recommendation of RFC 9106
+	seedKDFIterations = 3
+	seedKDFMemory     = 64 * 1024
+	seedKDFThreads    = 4
+	seedSaltLen       = 16
+	seedNonceLen      = 24
+	seedKeyLen        = 32
+)
+
+// ErrUnsupportedEncryptedKey is returned for encrypted private keys in a format that
+// ParseCryptoSignPrivateKey cannot decrypt.
+var ErrUnsupportedEncryptedKey = errors.New("unsupported encrypted format") //nolint:gochecknoglobals
+
+// ParseCryptoSignPrivateKey parses an Ed25519 private key in one of the formats
+// - unencrypted PKCS#8 PEM ("BEGIN PRIVATE KEY"), as written by openssl genpkey -algorithm ed25519
+// - OpenSSH ("BEGIN OPENSSH PRIVATE KEY"), as written by ssh-keygen -t ed25519
+// - a hex encoded 32 byte seed or 64 byte private key, as used by NewCryptoSignAuthenticator
+// - a passphrase protected seed ("BEGIN ENCRYPTED CRYPTOSIGN SEED"), as written by
+// EncryptCryptoSignSeed
+//
+// passphrase decrypts encrypted OpenSSH keys and seeds and is ignored for unencrypted
+// keys. Encrypted PKCS#8 keys ("BEGIN ENCRYPTED PRIVATE KEY") fail with
+// ErrUnsupportedEncryptedKey.
+func ParseCryptoSignPrivateKey(data, passphrase []byte) (ed25519.PrivateKey, error) {
+	data = bytes.TrimSpace(data)
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, fmt.Errorf("%w: encrypted PKCS#8, decrypt it with openssl pkcs8 first",
+				ErrUnsupportedEncryptedKey)
+		}
+
+		if block.Type == pemTypeEncryptedSeed {
+			return decryptSeed(block.Bytes, passphrase)
+		}
+
+		return parsePEMPrivateKey(data, passphrase)
+	}
+
+	raw, err := hex.DecodeString(string(data))
+	if err != nil {
+		return nil, errors.New("private key is neither PEM nor hex encoded")
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		privateKey := ed25519.NewKeyFromSeed(raw[:ed25519.SeedSize])
+		if !bytes.Equal(privateKey, raw) {
+			return nil, errors.New("public key part does not match the seed of the private key")
+		}
+
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("hex encoded private key must be %d or %d bytes, was %d", ed25519.SeedSize,
+			ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+func parsePEMPrivateKey(data, passphrase []byte) (ed25519.PrivateKey, error) {
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if len(passphrase) == 0 {
+			return nil, errors.New("private key is encrypted but no passphrase was given")
+		}
+
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *ed25519.PrivateKey:
+		return *key, nil
+	default:
+		return nil, fmt.Errorf("private key must be ed25519, was %T", key)
+	}
+}
+
+// EncryptCryptoSignSeed returns the seed of privateKey encrypted with passphrase as PEM, for
+// ParseCryptoSignPrivateKey to read back. The key is derived from the passphrase with
+// argon2id and the seed sealed with NaCl secretbox, the block holds salt, nonce and box.
+func EncryptCryptoSignSeed(privateKey ed25519.PrivateKey, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	header := make([]byte, seedSaltLen+seedNonceLen)
+	if _, err := rand.Read(header); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	var nonce [seedNonceLen]byte
+	copy(nonce[:], header[seedSaltLen:])
+	key := seedKey(passphrase, header[:seedSaltLen])
+	sealed := secretbox.Seal(header, privateKey.Seed(), &nonce, key)
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeEncryptedSeed, Bytes: sealed}), nil
+}
+
+func decryptSeed(data, passphrase []byte) (ed25519.PrivateKey, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("private key is encrypted but no passphrase was given")
+	}
+
+	if len(data) != seedSaltLen+seedNonceLen+secretbox.Overhead+ed25519.SeedSize {
+		return nil, errors.New("malformed encrypted seed")
+	}
+
+	var nonce [seedNonceLen]byte
+	copy(nonce[:], data[seedSaltLen:])
+	seed, ok := secretbox.Open(nil, data[seedSaltLen+seedNonceLen:], &nonce, seedKey(passphrase, data[:seedSaltLen]))
+	if !ok {
+		return nil, errors.New("failed to decrypt seed, wrong passphrase")
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func seedKey(passphrase, salt []byte) *[seedKeyLen]byte {
+	var key [seedKeyLen]byte
+	copy(key[:], argon2.IDKey(passphrase, salt, seedKDFIterations, seedKDFMemory, seedKDFThreads, seedKeyLen))
+	return &key
+}
+
+// LoadCryptoSignPrivateKey reads a private key file in one of the formats supported by
+// ParseCryptoSignPrivateKey.
+func LoadCryptoSignPrivateKey(path string, passphrase []byte) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCryptoSignPrivateKey(data, passphrase)
+}
+
+// CryptoSignPrivateKeyHex returns the hex encoded seed of privateKey, as accepted by
+// NewCryptoSignAuthenticator.
+func CryptoSignPrivateKeyHex(privateKey ed25519.PrivateKey) string {
+	return hex.EncodeToString(privateKey.Seed())
+}
+
+type sshAgentSigner struct {
+	agent     agent.Agent
+	publicKey ed25519.PublicKey
+	sshKey    ssh.PublicKey
+}
+
+// NewSSHAgentSigner returns a crypto.Signer for an Ed25519 key held by an ssh-agent, so
+// that the private key never has to be loaded into the process. The agent is usually
+// agent.NewClient on the connection to $SSH_AUTH_SOCK.
+func NewSSHAgentSigner(sshAgent agent.Agent, publicKey ed25519.PublicKey) (crypto.Signer, error) {
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := sshAgent.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if bytes.Equal(key.Marshal(), sshKey.Marshal()) {
+			return &sshAgentSigner{agent: sshAgent, publicKey: publicKey, sshKey: sshKey}, nil
+		}
+	}
+
+	return nil, errors.New("key is not held by the agent")
+}
+
+func (s *sshAgentSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign signs message like ed25519.PrivateKey.Sign, Ed25519 signs the message itself and
+// not a digest of it.
+func (s *sshAgentSigner) Sign(_ io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, errors.New("ed25519 cannot sign hashed messages")
+	}
+
+	signature, err := s.agent.Sign(s.sshKey, message)
+	if err != nil {
+		return nil, fmt.Errorf("agent failed to sign: %w", err)
+	}
+
+	if signature.Format != ssh.KeyAlgoED25519 {
+		return nil, fmt.Errorf("agent returned a %s signature", signature.Format)
+	}
+
+	return signature.Blob, nil
+}
@@ -0,0 +1,114 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/xconnio/wampproto-go/auth"
+)
+
+func TestParseCryptoSignPrivateKey(t *testing.T) {
+	seed, err := hex.DecodeString(testPrivateKey)
+	require.NoError(t, err)
+	privateKey := ed25519.NewKeyFromSeed(seed)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	openSSH, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("secret"))
+	require.NoError(t, err)
+	encryptedSeed, err := auth.EncryptCryptoSignSeed(privateKey, []byte("secret"))
+	require.NoError(t, err)
+
+	for name, data := range map[string][]byte{
+		"Seed":       []byte(testPrivateKey + "\n"),
+		"PrivateKey": []byte(hex.EncodeToString(privateKey)),
+		"PKCS8":      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		"OpenSSH":    pem.EncodeToMemory(openSSH),
+		"Encrypted":  pem.EncodeToMemory(encrypted),
+		"Passphrase": encryptedSeed,
+	} {
+		parsed, err := auth.ParseCryptoSignPrivateKey(data, []byte("secret"))
+		require.NoError(t, err, name)
+		require.Equal(t, privateKey, parsed, name)
+		require.Equal(t, testPrivateKey, auth.CryptoSignPrivateKeyHex(parsed))
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := auth.ParseCryptoSignPrivateKey(pem.EncodeToMemory(encrypted), nil)
+		require.EqualError(t, err, "private key is encrypted but no passphrase was given")
+
+		_, err = auth.ParseCryptoSignPrivateKey(pem.EncodeToMemory(encrypted), []byte("wrong"))
+		require.Error(t, err)
+
+		_, err = auth.ParseCryptoSignPrivateKey(encryptedSeed, nil)
+		require.EqualError(t, err, "private key is encrypted but no passphrase was given")
+
+		_, err = auth.ParseCryptoSignPrivateKey(encryptedSeed, []byte("wrong"))
+		require.EqualError(t, err, "failed to decrypt seed, wrong passphrase")
+
+		_, err = auth.EncryptCryptoSignSeed(privateKey, nil)
+		require.Error(t, err)
+
+		_, err = auth.ParseCryptoSignPrivateKey([]byte("abcd"), nil)
+		require.Error(t, err)
+
+		_, err = auth.ParseCryptoSignPrivateKey([]byte("not a key"), nil)
+		require.Error(t, err)
+
+		encryptedPKCS8 := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{0x30}})
+		_, err = auth.ParseCryptoSignPrivateKey(encryptedPKCS8, []byte("secret"))
+		require.True(t, errors.Is(err, auth.ErrUnsupportedEncryptedKey))
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "id_ed25519")
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(openSSH), 0o600))
+
+		parsed, err := auth.LoadCryptoSignPrivateKey(path, nil)
+		require.NoError(t, err)
+		require.Equal(t, privateKey, parsed)
+
+		seedPath := filepath.Join(t.TempDir(), "seed.pem")
+		require.NoError(t, os.WriteFile(seedPath, encryptedSeed, 0o600))
+
+		parsed, err = auth.LoadCryptoSignPrivateKey(seedPath, []byte("secret"))
+		require.NoError(t, err)
+		require.Equal(t, privateKey, parsed)
+	})
+}
+
+func TestSSHAgentSigner(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyring := agent.NewKeyring()
+	_, err = auth.NewSSHAgentSigner(keyring, publicKey)
+	require.Error(t, err)
+
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: privateKey}))
+	signer, err := auth.NewSSHAgentSigner(keyring, publicKey)
+	require.NoError(t, err)
+	require.Equal(t, publicKey, signer.Public())
+
+	message := []byte("challenge")
+	signature, err := signer.Sign(nil, message, crypto.Hash(0))
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(publicKey, message, signature))
+
+	_, err = signer.Sign(nil, message, crypto.SHA256)
+	require.Error(t, err)
+}
@@ -1,11 +1,14 @@
 package auth_test
 
 import (
+	"crypto"
 	"crypto/ed25519"
 	"encoding/hex"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/agent"
 
 	"github.com/xconnio/wampproto-go/auth"
 	"github.com/xconnio/wampproto-go/messages"
@@ -67,6 +70,88 @@ func TestNewCryptoSignAuthenticator(t *testing.T) {
 	})
 }
 
+type remoteSigner struct {
+	privateKey ed25519.PrivateKey
+	signed     int
+	err        error
+	// tamper makes the signer sign a different message
+	tamper bool
+}
+
+func (s *remoteSigner) PublicKey() ed25519.PublicKey {
+	return s.privateKey.Public().(ed25519.PublicKey)
+}
+
+func (s *remoteSigner) Sign(message []byte) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	s.signed++
+	if s.tamper {
+		message = append([]byte{0}, message...)
+	}
+
+	return ed25519.Sign(s.privateKey, message), nil
+}
+
+func TestCryptoSignAuthenticatorWithSigner(t *testing.T) {
+	seed, err := hex.DecodeString(testPrivateKey)
+	require.NoError(t, err)
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	challenge := messages.NewChallenge(auth.MethodCryptoSign, map[string]any{"challenge": testChallenge})
+
+	authenticate := func(t *testing.T, signer auth.ChallengeSigner) (*messages.Authenticate, error) {
+		authenticator, err := auth.NewCryptoSignAuthenticatorWithSigner(testAuthID, signer, nil)
+		require.NoError(t, err)
+		require.Equal(t, testPublicKey, authenticator.AuthExtra()["pubkey"])
+
+		return authenticator.Authenticate(*challenge)
+	}
+
+	t.Run("Interface", func(t *testing.T) {
+		signer := &remoteSigner{privateKey: privateKey}
+		result, err := authenticate(t, signer)
+		require.NoError(t, err)
+		require.Equal(t, 1, signer.signed)
+
+		verified, err := auth.VerifyCryptoSignSignatureWithChannelBinding(result.Signature(), testChallenge, nil,
+			publicKey)
+		require.NoError(t, err)
+		require.True(t, verified)
+
+		_, err = authenticate(t, &remoteSigner{privateKey: privateKey, err: errors.New("device locked")})
+		require.EqualError(t, err, "failed to sign challenge: device locked")
+
+		_, err = authenticate(t, &remoteSigner{privateKey: privateKey, tamper: true})
+		require.EqualError(t, err, "signer returned an invalid signature for the challenge")
+
+		_, err = auth.NewCryptoSignAuthenticatorWithSigner(testAuthID, nil, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("CryptoSigner", func(t *testing.T) {
+		keyring := agent.NewKeyring()
+		require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: privateKey}))
+		agentSigner, err := auth.NewSSHAgentSigner(keyring, publicKey)
+		require.NoError(t, err)
+
+		for _, cryptoSigner := range []crypto.Signer{agentSigner, privateKey} {
+			signer, err := auth.NewChallengeSigner(cryptoSigner)
+			require.NoError(t, err)
+
+			result, err := authenticate(t, signer)
+			require.NoError(t, err)
+
+			verified, err := auth.VerifyCryptoSignSignatureWithChannelBinding(result.Signature(), testChallenge, nil,
+				publicKey)
+			require.NoError(t, err)
+			require.True(t, verified)
+		}
+	})
+}
+
 func TestSignCryptoSignChallenge(t *testing.T) {
 	privateKey, err := hex.DecodeString(testPrivateKey + testPublicKey)
 	require.NoError(t, err)
@@ -95,6 +180,58 @@ func TestVerifyCryptoSignSignature(t *testing.T) {
 	require.True(t, isVerified)
 }
 
+func TestCryptoSignChannelBinding(t *testing.T) {
+	privateKey, err := hex.DecodeString(testPrivateKey + testPublicKey)
+	require.NoError(t, err)
+	publicKey, err := hex.DecodeString(testPublicKey)
+	require.NoError(t, err)
+
+	channelBinding := make([]byte, 32)
+	for i := range channelBinding {
+		channelBinding[i] = byte(i)
+	}
+
+	signature, err := auth.SignCryptoSignChallengeWithChannelBinding(testChallenge, channelBinding, privateKey)
+	require.NoError(t, err)
+
+	verified, err := auth.VerifyCryptoSignSignatureWithChannelBinding(signature, testChallenge, channelBinding, publicKey)
+	require.NoError(t, err)
+	require.True(t, verified)
+
+	// valid signature, but not over this challenge and channel
+	verified, err = auth.VerifyCryptoSignSignatureWithChannelBinding(signature, testChallenge, nil, publicKey)
+	require.NoError(t, err)
+	require.False(t, verified)
+
+	_, err = auth.SignCryptoSignChallengeWithChannelBinding(testChallenge, channelBinding[:16], privateKey)
+	require.Error(t, err)
+
+	t.Run("Authenticate", func(t *testing.T) {
+		binding := &auth.ChannelBinding{Type: auth.ChannelBindingTLSUnique, Data: channelBinding}
+		authenticator, err := auth.NewCryptoSignAuthenticatorWithChannelBinding(testAuthID, testPrivateKey, nil,
+			binding)
+		require.NoError(t, err)
+		require.Equal(t, auth.ChannelBindingTLSUnique, authenticator.AuthExtra()["channel_binding"])
+
+		challenge := messages.NewChallenge(auth.MethodCryptoSign, map[string]any{
+			"challenge":       testChallenge,
+			"channel_binding": auth.ChannelBindingTLSUnique,
+		})
+		authenticate, err := authenticator.Authenticate(*challenge)
+		require.NoError(t, err)
+
+		verified, err := auth.VerifyCryptoSignSignatureWithChannelBinding(authenticate.Signature(), testChallenge,
+			channelBinding, publicKey)
+		require.NoError(t, err)
+		require.True(t, verified)
+
+		// the router has to confirm it binds the challenge to the channel
+		challenge = messages.NewChallenge(auth.MethodCryptoSign, map[string]any{"challenge": testChallenge})
+		_, err = authenticator.Authenticate(*challenge)
+		require.Error(t, err)
+	})
+}
+
 func TestGenerateCryptoSignChallenge(t *testing.T) {
 	challenge, err := auth.GenerateCryptoSignChallenge()
 	require.NoError(t, err)
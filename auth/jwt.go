@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgEdDSA = "EdDSA"
+
+	defaultJWTRoleClaim      = "role"
+	defaultJWTAuthExtraClaim = "authextra"
+)
+
+// JWTTicketOptions configures a TicketVerifier for tickets that are JSON Web Tokens. At
+// least one of HMACKey and PublicKey is required, only the algorithms with a key are
+// accepted.
+type JWTTicketOptions struct {
+	// HMACKey verifies HS256 signed tokens.
+	HMACKey []byte
+	// PublicKey verifies EdDSA signed tokens.
+	PublicKey ed25519.PublicKey
+	// Issuer and Audience, if set, have to match the "iss" and "aud" claims.
+	Issuer   string
+	Audience string
+	// RoleClaim is the claim holding the authrole, defaults to "role".
+	RoleClaim string
+	// DefaultRole is the authrole of tokens without a role claim, such tokens are
+	// rejected if it is empty.
+	DefaultRole string
+	// AuthExtraClaim is the claim holding an object that becomes the authextra, defaults
+	// to "authextra".
+	AuthExtraClaim string
+	// Leeway is the clock skew tolerated for "exp" and "nbf".
+	Leeway time.Duration
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+type jwtTicketVerifier struct {
+	options JWTTicketOptions
+}
+
+// NewJWTTicketVerifier returns a TicketVerifier for JWT tickets. The "sub" claim is the
+// authid and has to match the authid from HELLO if the client sent one, "exp" is
+// required and limits the TTL of the response.
+func NewJWTTicketVerifier(options JWTTicketOptions) (TicketVerifier, error) {
+	if len(options.HMACKey) == 0 && len(options.PublicKey) == 0 {
+		return nil, errors.New("jwt: either an HMAC key or a public key is required")
+	}
+
+	if len(options.PublicKey) != 0 && len(options.PublicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("jwt: public key must be %d bytes", ed25519.PublicKeySize)
+	}
+
+	if options.RoleClaim == "" {
+		options.RoleClaim = defaultJWTRoleClaim
+	}
+
+	if options.AuthExtraClaim == "" {
+		options.AuthExtraClaim = defaultJWTAuthExtraClaim
+	}
+
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+
+	return &jwtTicketVerifier{options: options}, nil
+}
+
+func (v *jwtTicketVerifier) VerifyTicket(request *TicketRequest) (Response, error) {
+	claims, err := v.verifySignature(request.Ticket())
+	if err != nil {
+		return nil, err
+	}
+
+	now := v.options.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("jwt: exp claim missing")
+	}
+
+	expiry := time.Unix(int64(exp), 0)
+	if !now.Before(expiry.Add(v.options.Leeway)) {
+		return nil, errors.New("jwt: token expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.options.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("jwt: token not valid yet")
+	}
+
+	if v.options.Issuer != "" && claims["iss"] != v.options.Issuer {
+		return nil, fmt.Errorf("jwt: unexpected issuer %v", claims["iss"])
+	}
+
+	if v.options.Audience != "" && !audienceMatches(claims["aud"], v.options.Audience) {
+		return nil, fmt.Errorf("jwt: unexpected audience %v", claims["aud"])
+	}
+
+	authID, _ := claims["sub"].(string)
+	if authID == "" {
+		return nil, errors.New("jwt: sub claim missing")
+	}
+
+	if request.AuthID() != "" && request.AuthID() != authID {
+		return nil, fmt.Errorf("jwt: token was issued for %q, not %q", authID, request.AuthID())
+	}
+
+	authRole, _ := claims[v.options.RoleClaim].(string)
+	if authRole == "" {
+		if v.options.DefaultRole == "" {
+			return nil, fmt.Errorf("jwt: %s claim missing", v.options.RoleClaim)
+		}
+
+		authRole = v.options.DefaultRole
+	}
+
+	authExtra, _ := claims[v.options.AuthExtraClaim].(map[string]any)
+
+	ttl := expiry.Sub(now)
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return NewResponseWithExtra(authID, authRole, "jwt", authExtra, ttl)
+}
+
+func (v *jwtTicketVerifier) verifySignature(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jwt: malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("jwt: malformed header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: malformed signature: %w", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == JWTAlgHS256 && len(v.options.HMACKey) > 0:
+		mac := hmac.New(sha256.New, v.options.HMACKey)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, errors.New("jwt: invalid signature")
+		}
+	case header.Alg == JWTAlgEdDSA && len(v.options.PublicKey) > 0:
+		if !ed25519.Verify(v.options.PublicKey, signed, signature) {
+			return nil, errors.New("jwt: invalid signature")
+		}
+	default:
+		return nil, fmt.Errorf("jwt: algorithm %q not accepted", header.Alg)
+	}
+
+	claims := map[string]any{}
+	if err = decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("jwt: malformed claims: %w", err)
+	}
+
+	return claims, nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func audienceMatches(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, entry := range aud {
+			if entry == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/util"
+)
+
+const (
+	MethodSCRAM = "wamp-scram"
+
+	SCRAMKDFArgon2 = "argon2id13"
+	SCRAMKDFPBKDF2 = "pbkdf2"
+
+	// defaults follow the OWASP password storage recommendations
+	DefaultSCRAMArgon2Iterations = 2
+	DefaultSCRAMArgon2Memory     = 19 * 1024
+	DefaultSCRAMPBKDF2Iterations = 600000
+
+	// limits of the parameters a client accepts from the router unless configured otherwise
+	DefaultSCRAMMaxPBKDF2Iterations = 4 * DefaultSCRAMPBKDF2Iterations
+	DefaultSCRAMMaxArgon2Iterations = 16
+	DefaultSCRAMMaxArgon2Memory     = 64 * 1024
+
+	scramNonceLen = 16
+	scramSaltLen  = 16
+	scramKeyLen   = 32
+)
+
+// SCRAMClientOptions limits the key derivation parameters a client accepts in CHALLENGE,
+// so that a malicious router cannot make it burn CPU and memory. Zero values select the
+// defaults.
+type SCRAMClientOptions struct {
+	// MaxIterations is the highest pbkdf2 iteration count, defaults to
+	// DefaultSCRAMMaxPBKDF2Iterations.
+	MaxIterations int
+	// MaxArgon2Iterations is the highest argon2id iteration count, defaults to
+	// DefaultSCRAMMaxArgon2Iterations.
+	MaxArgon2Iterations int
+	// MaxMemory is the highest argon2id memory cost in KiB, defaults to
+	// DefaultSCRAMMaxArgon2Memory.
+	MaxMemory int
+}
+
+func (o SCRAMClientOptions) check(params SCRAMParams) error {
+	switch params.KDF {
+	case SCRAMKDFArgon2:
+		if params.Iterations > o.MaxArgon2Iterations || params.Memory > o.MaxMemory {
+			return fmt.Errorf("scram: argon2id13 iterations %d and memory %d exceed the limits %d and %d",
+				params.Iterations, params.Memory, o.MaxArgon2Iterations, o.MaxMemory)
+		}
+	case SCRAMKDFPBKDF2:
+		if params.Iterations > o.MaxIterations {
+			return fmt.Errorf("scram: pbkdf2 iterations %d exceed the limit %d", params.Iterations,
+				o.MaxIterations)
+		}
+	}
+
+	return nil
+}
+
+type scramAuthenticator struct {
+	authID    string
+	authExtra map[string]any
+	options   SCRAMClientOptions
+
+	secret string
+	nonce  string
+	// serverSignature is what the router has to send in WELCOME to prove that it knows
+	// the credential too.
+	serverSignature []byte
+}
+
+// NewSCRAMAuthenticator returns a ClientAuthenticator for WAMP-SCRAM. The client nonce is
+// generated here and sent in the authextra of HELLO.
+func NewSCRAMAuthenticator(authID string, secret string, authExtra map[string]any) (ClientAuthenticator, error) {
+	return NewSCRAMAuthenticatorWithOptions(authID, secret, authExtra, nil)
+}
+
+// NewSCRAMAuthenticatorWithOptions is like NewSCRAMAuthenticator with limits for the key
+// derivation parameters, nil options select the default limits.
+func NewSCRAMAuthenticatorWithOptions(authID string, secret string, authExtra map[string]any,
+	options *SCRAMClientOptions) (ClientAuthenticator, error) {
+	limits := SCRAMClientOptions{}
+	if options != nil {
+		limits = *options
+	}
+
+	if limits.MaxIterations == 0 {
+		limits.MaxIterations = DefaultSCRAMMaxPBKDF2Iterations
+	}
+
+	if limits.MaxArgon2Iterations == 0 {
+		limits.MaxArgon2Iterations = DefaultSCRAMMaxArgon2Iterations
+	}
+
+	if limits.MaxMemory == 0 {
+		limits.MaxMemory = DefaultSCRAMMaxArgon2Memory
+	}
+
+	nonce, err := randomBase64(scramNonceLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	extra := make(map[string]any, len(authExtra)+2)
+	for key, value := range authExtra {
+		extra[key] = value
+	}
+	extra["nonce"] = nonce
+	extra["channel_binding"] = nil
+
+	return &scramAuthenticator{
+		authID:    authID,
+		authExtra: extra,
+		options:   limits,
+		secret:    secret,
+		nonce:     nonce,
+	}, nil
+}
+
+func (a *scramAuthenticator) AuthMethod() string {
+	return MethodSCRAM
+}
+
+func (a *scramAuthenticator) AuthID() string {
+	return a.authID
+}
+
+func (a *scramAuthenticator) AuthExtra() map[string]any {
+	return a.authExtra
+}
+
+func (a *scramAuthenticator) Authenticate(challenge messages.Challenge) (*messages.Authenticate, error) {
+	nonce, _ := challenge.Extra()["nonce"].(string)
+	if !strings.HasPrefix(nonce, a.nonce) || len(nonce) == len(a.nonce) {
+		return nil, errors.New("scram: server nonce does not extend the client nonce")
+	}
+
+	params, err := scramParamsFromChallenge(challenge.Extra())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = a.options.check(params); err != nil {
+		return nil, err
+	}
+
+	saltedPassword, err := params.saltedPassword(a.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	clientKey := scramHMAC(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	authMessage := SCRAMAuthMessage(a.authID, a.nonce, nonce, params.Salt, params.Iterations, "")
+	clientSignature := scramHMAC(storedKey[:], authMessage)
+
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	a.serverSignature = scramHMAC(scramHMAC(saltedPassword, "Server Key"), authMessage)
+
+	return messages.NewAuthenticate(base64.StdEncoding.EncodeToString(proof), nil), nil
+}
+
+// VerifyWelcome checks the server signature the router sent in WELCOME.
+func (a *scramAuthenticator) VerifyWelcome(authExtra map[string]any) error {
+	if a.serverSignature == nil {
+		return errors.New("scram: router sent WELCOME without authenticating")
+	}
+
+	encoded, _ := authExtra["scram_server_signature"].(string)
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal(signature, a.serverSignature) {
+		return errors.New("scram: invalid server signature")
+	}
+
+	return nil
+}
+
+// SCRAMParams are the key derivation parameters of a SCRAM credential.
+type SCRAMParams struct {
+	KDF string
+	// Salt is base64 encoded.
+	Salt       string
+	Iterations int
+	// Memory is the memory cost of argon2id in KiB, unused for pbkdf2.
+	Memory int
+}
+
+func scramParamsFromChallenge(extra map[string]any) (SCRAMParams, error) {
+	params := SCRAMParams{}
+	params.KDF, _ = extra["kdf"].(string)
+	params.Salt, _ = extra["salt"].(string)
+	params.Iterations, _ = util.AsInt(extra["iterations"])
+	params.Memory, _ = util.AsInt(extra["memory"])
+
+	if params.Salt == "" || params.Iterations <= 0 {
+		return params, errors.New("scram: challenge lacks salt or iterations")
+	}
+
+	return params, nil
+}
+
+func (p SCRAMParams) saltedPassword(secret string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(p.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("scram: malformed salt: %w", err)
+	}
+
+	switch p.KDF {
+	case SCRAMKDFArgon2:
+		if p.Memory <= 0 {
+			return nil, errors.New("scram: argon2id13 requires the memory parameter")
+		}
+
+		iterations, _ := util.AsUInt64(p.Iterations)
+		memory, _ := util.AsUInt64(p.Memory)
+		return argon2.IDKey([]byte(secret), salt, uint32(iterations), uint32(memory), 1, scramKeyLen), nil // #nosec
+	case SCRAMKDFPBKDF2:
+		return pbkdf2.Key([]byte(secret), salt, p.Iterations, scramKeyLen, sha256.New), nil
+	default:
+		return nil, fmt.Errorf("scram: unsupported kdf %q", p.KDF)
+	}
+}
+
+// challengeExtra returns the extra of the CHALLENGE sent for these parameters.
+func (p SCRAMParams) challengeExtra(nonce string) map[string]any {
+	extra := map[string]any{
+		"nonce":      nonce,
+		"salt":       p.Salt,
+		"kdf":        p.KDF,
+		"iterations": p.Iterations,
+	}
+
+	if p.KDF == SCRAMKDFArgon2 {
+		extra["memory"] = p.Memory
+	}
+
+	return extra
+}
+
+// SCRAMCredential is what a server stores instead of the password of a SCRAM user.
+type SCRAMCredential struct {
+	SCRAMParams
+	// StoredKey and ServerKey are base64 encoded.
+	StoredKey string
+	ServerKey string
+}
+
+// NewSCRAMCredential derives the credential to store for secret with a random salt. For
+// argon2id13, zero iterations and memory select DefaultSCRAMArgon2Iterations and
+// DefaultSCRAMArgon2Memory, for pbkdf2 zero iterations select DefaultSCRAMPBKDF2Iterations.
+func NewSCRAMCredential(secret, kdf string, iterations, memory int) (*SCRAMCredential, error) {
+	salt, err := randomBase64(scramSaltLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	switch kdf {
+	case SCRAMKDFArgon2:
+		if iterations == 0 {
+			iterations = DefaultSCRAMArgon2Iterations
+		}
+		if memory == 0 {
+			memory = DefaultSCRAMArgon2Memory
+		}
+	case SCRAMKDFPBKDF2:
+		if iterations == 0 {
+			iterations = DefaultSCRAMPBKDF2Iterations
+		}
+		memory = 0
+	}
+
+	return DeriveSCRAMCredential(secret, SCRAMParams{KDF: kdf, Salt: salt, Iterations: iterations, Memory: memory})
+}
+
+// DeriveSCRAMCredential derives the credential for secret with the given parameters.
+func DeriveSCRAMCredential(secret string, params SCRAMParams) (*SCRAMCredential, error) {
+	saltedPassword, err := params.saltedPassword(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	storedKey := sha256.Sum256(scramHMAC(saltedPassword, "Client Key"))
+	return &SCRAMCredential{
+		SCRAMParams: params,
+		StoredKey:   base64.StdEncoding.EncodeToString(storedKey[:]),
+		ServerKey:   base64.StdEncoding.EncodeToString(scramHMAC(saltedPassword, "Server Key")),
+	}, nil
+}
+
+// SCRAMAuthMessage returns the message both sides sign. The nonce is the combined client
+// and server nonce and channelBinding is the base64 encoded channel binding data, if any.
+func SCRAMAuthMessage(authID, clientNonce, nonce, salt string, iterations int, channelBinding string) string {
+	clientFirstBare := fmt.Sprintf("n=%s,r=%s", authID, clientNonce)
+	serverFirst := fmt.Sprintf("r=%s,s=%s,i=%d", nonce, salt, iterations)
+	clientFinalNoProof := fmt.Sprintf("c=%s,r=%s", channelBinding, nonce)
+	return strings.Join([]string{clientFirstBare, serverFirst, clientFinalNoProof}, ",")
+}
+
+// VerifySCRAMProof checks the base64 encoded client proof against credential and returns
+// the base64 encoded server signature the client can verify the server with.
+func VerifySCRAMProof(credential *SCRAMCredential, authMessage, proof string) (string, error) {
+	storedKey, err := base64.StdEncoding.DecodeString(credential.StoredKey)
+	if err != nil {
+		return "", fmt.Errorf("scram: malformed stored key: %w", err)
+	}
+
+	serverKey, err := base64.StdEncoding.DecodeString(credential.ServerKey)
+	if err != nil {
+		return "", fmt.Errorf("scram: malformed server key: %w", err)
+	}
+
+	clientProof, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil || len(clientProof) != sha256.Size {
+		return "", errors.New("scram: malformed client proof")
+	}
+
+	clientSignature := scramHMAC(storedKey, authMessage)
+	clientKey := make([]byte, len(clientProof))
+	for i := range clientProof {
+		clientKey[i] = clientProof[i] ^ clientSignature[i]
+	}
+
+	computedStoredKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(computedStoredKey[:], storedKey) != 1 {
+		return "", errors.New("scram: invalid client proof")
+	}
+
+	return base64.StdEncoding.EncodeToString(scramHMAC(serverKey, authMessage)), nil
+}
+
+// GenerateSCRAMChallenge returns the CHALLENGE extra for credential, extending the nonce
+// the client sent in HELLO with a server nonce.
+func GenerateSCRAMChallenge(credential *SCRAMCredential, clientNonce string) (map[string]any, error) {
+	if credential == nil {
+		return nil, errors.New("scram: no credential to generate the challenge for")
+	}
+
+	serverNonce, err := randomBase64(scramNonceLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return credential.challengeExtra(clientNonce + serverNonce), nil
+}
+
+func NewSCRAMRequest(hello *messages.Hello, nonce string) Request {
+	return &SCRAMRequest{
+		Request: NewRequest(hello, SCRAM),
+		nonce:   nonce,
+	}
+}
+
+type SCRAMRequest struct {
+	Request
+
+	nonce string
+}
+
+// Nonce returns the client nonce from HELLO.
+func (r *SCRAMRequest) Nonce() string {
+	return r.nonce
+}
+
+type SCRAMResponse struct {
+	Response
+
+	credential *SCRAMCredential
+}
+
+// NewSCRAMResponse returns the Response for a SCRAM request, the client has to prove it
+// knows the password credential was derived from.
+func NewSCRAMResponse(authID, authRole string, credential *SCRAMCredential, ttl time.Duration) Response {
+	response, _ := NewResponse(authID, authRole, ttl)
+	return &SCRAMResponse{
+		Response:   response,
+		credential: credential,
+	}
+}
+
+func (r *SCRAMResponse) Credential() *SCRAMCredential {
+	return r.credential
+}
+
+func scramHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func randomBase64(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
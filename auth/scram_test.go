@@ -0,0 +1,104 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+)
+
+func TestSCRAMAuthenticator(t *testing.T) {
+	authenticator, err := auth.NewSCRAMAuthenticator(testAuthID, "secret", map[string]any{"foo": "bar"})
+	require.NoError(t, err)
+	require.Equal(t, auth.MethodSCRAM, authenticator.AuthMethod())
+	require.Equal(t, "bar", authenticator.AuthExtra()["foo"])
+
+	clientNonce, _ := authenticator.AuthExtra()["nonce"].(string)
+	require.NotEmpty(t, clientNonce)
+
+	for _, kdf := range []string{auth.SCRAMKDFArgon2, auth.SCRAMKDFPBKDF2} {
+		t.Run(kdf, func(t *testing.T) {
+			credential, err := auth.NewSCRAMCredential("secret", kdf, 1, 64)
+			require.NoError(t, err)
+
+			// the credential only depends on the secret and the parameters
+			derived, err := auth.DeriveSCRAMCredential("secret", credential.SCRAMParams)
+			require.NoError(t, err)
+			require.Equal(t, credential, derived)
+
+			extra, err := auth.GenerateSCRAMChallenge(credential, clientNonce)
+			require.NoError(t, err)
+			nonce := extra["nonce"].(string)
+
+			authenticate, err := authenticator.Authenticate(*messages.NewChallenge(auth.MethodSCRAM, extra))
+			require.NoError(t, err)
+
+			authMessage := auth.SCRAMAuthMessage(testAuthID, clientNonce, nonce, credential.Salt,
+				credential.Iterations, "")
+			serverSignature, err := auth.VerifySCRAMProof(credential, authMessage, authenticate.Signature())
+			require.NoError(t, err)
+			require.NotEmpty(t, serverSignature)
+
+			verifier := authenticator.(auth.WelcomeVerifier)
+			require.NoError(t, verifier.VerifyWelcome(map[string]any{"scram_server_signature": serverSignature}))
+			require.Error(t, verifier.VerifyWelcome(map[string]any{"scram_server_signature": authenticate.Signature()}))
+			require.Error(t, verifier.VerifyWelcome(nil))
+
+			wrong, err := auth.DeriveSCRAMCredential("wrong", credential.SCRAMParams)
+			require.NoError(t, err)
+			_, err = auth.VerifySCRAMProof(wrong, authMessage, authenticate.Signature())
+			require.Error(t, err)
+		})
+	}
+
+	t.Run("WelcomeWithoutChallenge", func(t *testing.T) {
+		authenticator, err := auth.NewSCRAMAuthenticator(testAuthID, "secret", nil)
+		require.NoError(t, err)
+		require.Error(t, authenticator.(auth.WelcomeVerifier).VerifyWelcome(nil))
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		limited, err := auth.NewSCRAMAuthenticatorWithOptions(testAuthID, "secret", nil,
+			&auth.SCRAMClientOptions{MaxIterations: 10, MaxArgon2Iterations: 2, MaxMemory: 64})
+		require.NoError(t, err)
+		limitedNonce, _ := limited.AuthExtra()["nonce"].(string)
+
+		for _, params := range []auth.SCRAMParams{
+			{KDF: auth.SCRAMKDFPBKDF2, Iterations: 11},
+			{KDF: auth.SCRAMKDFArgon2, Iterations: 3, Memory: 64},
+			{KDF: auth.SCRAMKDFArgon2, Iterations: 2, Memory: 65},
+		} {
+			params.Salt = "c2FsdA=="
+			extra, err := auth.GenerateSCRAMChallenge(&auth.SCRAMCredential{SCRAMParams: params}, limitedNonce)
+			require.NoError(t, err)
+
+			_, err = limited.Authenticate(*messages.NewChallenge(auth.MethodSCRAM, extra))
+			require.Error(t, err, params)
+			require.Contains(t, err.Error(), "exceed")
+		}
+
+		// the default limits reject a terabyte of memory
+		extra := map[string]any{"nonce": clientNonce + "x", "salt": "c2FsdA==", "kdf": auth.SCRAMKDFArgon2,
+			"iterations": auth.DefaultSCRAMArgon2Iterations, "memory": 1024 * 1024 * 1024}
+		_, err = authenticator.Authenticate(*messages.NewChallenge(auth.MethodSCRAM, extra))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "exceed")
+	})
+
+	t.Run("ForeignNonce", func(t *testing.T) {
+		credential, err := auth.NewSCRAMCredential("secret", auth.SCRAMKDFPBKDF2, 1, 0)
+		require.NoError(t, err)
+		extra, err := auth.GenerateSCRAMChallenge(credential, "other")
+		require.NoError(t, err)
+
+		_, err = authenticator.Authenticate(*messages.NewChallenge(auth.MethodSCRAM, extra))
+		require.Error(t, err)
+	})
+
+	t.Run("NoCredential", func(t *testing.T) {
+		_, err := auth.GenerateSCRAMChallenge(nil, "nonce")
+		require.Error(t, err)
+	})
+}
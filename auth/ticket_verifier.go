@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2idTime    = 2
+	argon2idMemory  = 19 * 1024
+	argon2idThreads = 1
+	argon2idKeyLen  = 32
+	argon2idSaltLen = 16
+)
+
+// TicketVerifier checks the ticket of a client and returns who it authenticated as.
+type TicketVerifier interface {
+	VerifyTicket(request *TicketRequest) (Response, error)
+}
+
+// TicketVerifierFunc adapts a function to a TicketVerifier.
+type TicketVerifierFunc func(request *TicketRequest) (Response, error)
+
+func (f TicketVerifierFunc) VerifyTicket(request *TicketRequest) (Response, error) {
+	return f(request)
+}
+
+type ticketServerAuthenticator struct {
+	verifier TicketVerifier
+}
+
+// NewTicketServerAuthenticator returns a ServerAuthenticator for ticket authentication
+// that leaves checking the tickets to verifier.
+func NewTicketServerAuthenticator(verifier TicketVerifier) ServerAuthenticator {
+	return &ticketServerAuthenticator{verifier: verifier}
+}
+
+func (a *ticketServerAuthenticator) Methods() []Method {
+	return []Method{Ticket}
+}
+
+func (a *ticketServerAuthenticator) Authenticate(request Request) (Response, error) {
+	ticketRequest, ok := request.(*TicketRequest)
+	if !ok {
+		return nil, fmt.Errorf("ticket authenticator cannot handle %s requests", request.AuthMethod())
+	}
+
+	return a.verifier.VerifyTicket(ticketRequest)
+}
+
+// TicketPrincipal is a client known to a static ticket verifier.
+type TicketPrincipal struct {
+	// Secret is either the ticket itself, a bcrypt hash of it or an argon2id hash of it in
+	// PHC string format, as returned by HashTicket.
+	Secret    string
+	AuthRole  string
+	AuthExtra map[string]any
+}
+
+type staticTicketVerifier struct {
+	principals map[string]TicketPrincipal
+}
+
+// NewStaticTicketVerifier returns a TicketVerifier for a fixed set of principals keyed by
+// authid.
+func NewStaticTicketVerifier(principals map[string]TicketPrincipal) TicketVerifier {
+	return &staticTicketVerifier{principals: principals}
+}
+
+func (v *staticTicketVerifier) VerifyTicket(request *TicketRequest) (Response, error) {
+	principal, exists := v.principals[request.AuthID()]
+	if !exists {
+		return nil, fmt.Errorf("unknown authid %q", request.AuthID())
+	}
+
+	if err := VerifyTicketSecret(principal.Secret, request.Ticket()); err != nil {
+		return nil, err
+	}
+
+	return NewResponseWithExtra(request.AuthID(), principal.AuthRole, "static", principal.AuthExtra, 0)
+}
+
+// VerifyTicketSecret checks ticket against a secret in one of the formats supported by
+// TicketPrincipal.Secret.
+func VerifyTicketSecret(secret, ticket string) error {
+	switch {
+	case strings.HasPrefix(secret, "$argon2id$"):
+		return verifyArgon2id(secret, ticket)
+	case strings.HasPrefix(secret, "$2a$"), strings.HasPrefix(secret, "$2b$"), strings.HasPrefix(secret, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(secret), []byte(ticket)); err != nil {
+			return errors.New("invalid ticket")
+		}
+
+		return nil
+	default:
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(ticket)) != 1 {
+			return errors.New("invalid ticket")
+		}
+
+		return nil
+	}
+}
+
+// HashTicket returns an argon2id hash of ticket in PHC string format.
+func HashTicket(ticket string) (string, error) {
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(ticket), salt, argon2idTime, argon2idMemory, argon2idThreads, argon2idKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2idMemory, argon2idTime,
+		argon2idThreads, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func verifyArgon2id(secret, ticket string) error {
+	// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+	parts := strings.Split(secret, "$")
+	if len(parts) != 6 {
+		return errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+
+	// argon2 panics on zero parameters
+	if memory == 0 || iterations == 0 || threads == 0 {
+		return fmt.Errorf("malformed argon2id parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+
+	if len(hash) == 0 {
+		return errors.New("malformed argon2id hash: hash is empty")
+	}
+
+	key := argon2.IDKey([]byte(ticket), salt, iterations, memory, threads, uint32(len(hash))) // #nosec
+	if subtle.ConstantTimeCompare(key, hash) != 1 {
+		return errors.New("invalid ticket")
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+)
+
+func ticketRequest(authID, ticket string) *auth.TicketRequest {
+	hello := messages.NewHello("realm1", authID, nil, nil, []string{auth.MethodTicket})
+	return auth.NewTicketRequest(hello, ticket).(*auth.TicketRequest)
+}
+
+func TestStaticTicketVerifier(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-ticket"), bcrypt.MinCost)
+	require.NoError(t, err)
+	argon2Hash, err := auth.HashTicket("argon2-ticket")
+	require.NoError(t, err)
+
+	verifier := auth.NewStaticTicketVerifier(map[string]auth.TicketPrincipal{
+		"plain":  {Secret: "plain-ticket", AuthRole: "user", AuthExtra: map[string]any{"tenant": "acme"}},
+		"bcrypt": {Secret: string(bcryptHash), AuthRole: "user"},
+		"argon2": {Secret: argon2Hash, AuthRole: "admin"},
+	})
+
+	for authID, ticket := range map[string]string{
+		"plain":  "plain-ticket",
+		"bcrypt": "bcrypt-ticket",
+		"argon2": "argon2-ticket",
+	} {
+		response, err := verifier.VerifyTicket(ticketRequest(authID, ticket))
+		require.NoError(t, err, authID)
+		require.Equal(t, authID, response.AuthID())
+
+		_, err = verifier.VerifyTicket(ticketRequest(authID, ticket+"x"))
+		require.EqualError(t, err, "invalid ticket", authID)
+	}
+
+	response, err := verifier.VerifyTicket(ticketRequest("plain", "plain-ticket"))
+	require.NoError(t, err)
+	require.Equal(t, "user", response.AuthRole())
+	require.Equal(t, map[string]any{"tenant": "acme"}, response.(auth.ResponseWithExtra).AuthExtra())
+
+	_, err = verifier.VerifyTicket(ticketRequest("unknown", "plain-ticket"))
+	require.Error(t, err)
+
+	t.Run("MalformedArgon2id", func(t *testing.T) {
+		for _, secret := range []string{
+			"$argon2id$v=19$m=0,t=2,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+			"$argon2id$v=19$m=19456,t=0,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+			"$argon2id$v=19$m=19456,t=2,p=0$c2FsdHNhbHQ$aGFzaGhhc2g",
+			"$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$",
+		} {
+			verifier := auth.NewStaticTicketVerifier(map[string]auth.TicketPrincipal{
+				"argon2": {Secret: secret, AuthRole: "admin"},
+			})
+			_, err := verifier.VerifyTicket(ticketRequest("argon2", "argon2-ticket"))
+			require.Error(t, err, secret)
+		}
+	})
+}
+
+func signJWT(t *testing.T, alg string, key any, claims map[string]any) string {
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := encode(map[string]any{"alg": alg, "typ": "JWT"}) + "." + encode(claims)
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signed))
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTTicketVerifier(t *testing.T) {
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	verifier, err := auth.NewJWTTicketVerifier(auth.JWTTicketOptions{
+		HMACKey:   hmacKey,
+		PublicKey: publicKey,
+		Issuer:    "issuer",
+		Now:       func() time.Time { return now },
+	})
+	require.NoError(t, err)
+
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{
+			"sub":       "alice",
+			"iss":       "issuer",
+			"exp":       now.Add(time.Hour).Unix(),
+			"role":      "user",
+			"authextra": map[string]any{"tenant": "acme"},
+		}
+		for key, value := range extra {
+			c[key] = value
+		}
+		return c
+	}
+
+	t.Run("HS256", func(t *testing.T) {
+		response, err := verifier.VerifyTicket(ticketRequest("alice", signJWT(t, auth.JWTAlgHS256, hmacKey, claims(nil))))
+		require.NoError(t, err)
+		require.Equal(t, "alice", response.AuthID())
+		require.Equal(t, "user", response.AuthRole())
+		require.Equal(t, map[string]any{"tenant": "acme"}, response.(auth.ResponseWithExtra).AuthExtra())
+		require.Equal(t, time.Hour, response.TTL())
+	})
+
+	t.Run("EdDSA", func(t *testing.T) {
+		ticket := signJWT(t, auth.JWTAlgEdDSA, privateKey, claims(nil))
+		response, err := verifier.VerifyTicket(ticketRequest("", ticket))
+		require.NoError(t, err)
+		require.Equal(t, "alice", response.AuthID())
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		for name, ticket := range map[string]string{
+			"Expired":      signJWT(t, auth.JWTAlgHS256, hmacKey, claims(map[string]any{"exp": now.Unix()})),
+			"NoExpiry":     signJWT(t, auth.JWTAlgHS256, hmacKey, claims(map[string]any{"exp": nil})),
+			"WrongIssuer":  signJWT(t, auth.JWTAlgHS256, hmacKey, claims(map[string]any{"iss": "other"})),
+			"WrongSubject": signJWT(t, auth.JWTAlgHS256, hmacKey, claims(map[string]any{"sub": "bob"})),
+			"WrongKey":     signJWT(t, auth.JWTAlgHS256, []byte("another key"), claims(nil)),
+			"NoRole":       signJWT(t, auth.JWTAlgHS256, hmacKey, claims(map[string]any{"role": nil})),
+			"None":         signJWT(t, "none", nil, claims(nil)),
+			"Malformed":    "not.a.jwt",
+		} {
+			_, err := verifier.VerifyTicket(ticketRequest("alice", ticket))
+			require.Error(t, err, name)
+		}
+	})
+
+	t.Run("DefaultRole", func(t *testing.T) {
+		verifier, err := auth.NewJWTTicketVerifier(auth.JWTTicketOptions{
+			HMACKey:     hmacKey,
+			DefaultRole: "guest",
+			Now:         func() time.Time { return now },
+		})
+		require.NoError(t, err)
+
+		ticket := signJWT(t, auth.JWTAlgHS256, hmacKey, claims(map[string]any{"role": nil}))
+		response, err := verifier.VerifyTicket(ticketRequest("alice", ticket))
+		require.NoError(t, err)
+		require.Equal(t, "guest", response.AuthRole())
+	})
+
+	t.Run("ServerAuthenticator", func(t *testing.T) {
+		authenticator := auth.NewTicketServerAuthenticator(verifier)
+		require.Equal(t, []auth.Method{auth.Ticket}, authenticator.Methods())
+
+		ticket := signJWT(t, auth.JWTAlgHS256, hmacKey, claims(nil))
+		response, err := authenticator.Authenticate(ticketRequest("alice", ticket))
+		require.NoError(t, err)
+		require.Equal(t, "alice", response.AuthID())
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/pbkdf2"
 
@@ -115,6 +116,12 @@ func VerifyWAMPCRASignature(sig, chal string, key []byte) bool {
 }
 
 func GenerateWAMPCRAChallenge(session uint64, authid, authrole, provider string) (string, error) {
+	return GenerateWAMPCRAChallengeAt(session, authid, authrole, provider, time.Now())
+}
+
+// GenerateWAMPCRAChallengeAt is GenerateWAMPCRAChallenge with the timestamp of the
+// challenge set to now.
+func GenerateWAMPCRAChallengeAt(session uint64, authid, authrole, provider string, now time.Time) (string, error) {
 	nonce, err := makeNonce()
 	if err != nil {
 		return "", fmt.Errorf("failed to get nonce: %w", err)
@@ -124,7 +131,7 @@ func GenerateWAMPCRAChallenge(session uint64, authid, authrole, provider string)
 		"nonce":        nonce,
 		"authprovider": provider,
 		"authid":       authid,
-		"timestamp":    NowISO8601(),
+		"timestamp":    ISO8601(now),
 		"authrole":     authrole,
 		"authmethod":   MethodCRA,
 		"session":      session,
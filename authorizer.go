@@ -0,0 +1,38 @@
+package wampproto
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/xconnio/wampproto-go/messages"
+)
+
+// Authorizer decides whether a session may send a CALL, REGISTER, PUBLISH or SUBSCRIBE.
+// A denied message is answered with ERROR wamp.error.not_authorized, an error with
+// wamp.error.authorization_failed.
+type Authorizer interface {
+	Authorize(session *SessionDetails, msg messages.Message) (bool, error)
+}
+
+// authorize returns the error URI to answer msg with, or an empty string if it is allowed.
+func authorize(authorizer Authorizer, logger *slog.Logger, session *SessionDetails, msg messages.Message) string {
+	if authorizer == nil {
+		return ""
+	}
+
+	allowed, err := authorizer.Authorize(session, msg)
+	if err != nil {
+		logger.Warn("authorization failed", "session", session.ID(), "message", msg.Type(), "error", err)
+		return ErrAuthorizationFailed
+	}
+
+	if !allowed {
+		return ErrNotAuthorized
+	}
+
+	return ""
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -2,6 +2,9 @@ package wampproto
 
 import (
 	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/hashicorp/go-immutable-radix/v2"
@@ -12,28 +15,103 @@ import (
 
 const (
 	OptAcknowledge = "acknowledge"
+	OptRetain      = "retain"
+	OptGetRetained = "get_retained"
+
+	// DetailRetained marks an EVENT that was retained by the broker and sent on subscribe.
+	DetailRetained = "retained"
 )
 
+// storedEvent is a publication kept by the broker as retained event or in the history.
+type storedEvent struct {
+	seq           uint64
+	publicationID uint64
+	topic         string
+	details       map[string]any
+	args          []any
+	kwArgs        map[string]any
+	filter        *publishFilter
+}
+
+func (s *storedEvent) event(subscriptionID uint64, extra map[string]any) *messages.Event {
+	details := make(map[string]any, len(s.details)+len(extra)+1)
+	for key, value := range s.details {
+		details[key] = value
+	}
+	for key, value := range extra {
+		details[key] = value
+	}
+	details["topic"] = s.topic
+
+	return messages.NewEvent(subscriptionID, s.publicationID, details, s.args, s.kwArgs)
+}
+
 type Broker struct {
-	subscriptionsByTopic   map[string]*Subscription
+	subscriptionsByTopic   map[uriMatch]*Subscription
 	subscriptionsBySession map[uint64]map[uint64]*Subscription
 	sessions               map[uint64]*SessionDetails
 	prefixTree             *iradix.Tree[*Subscription]
 	wcSubscriptionsByTopic map[string]*Subscription
 	details                bool
+	allowDisclose          bool
+	uriValidation          URIValidationMode
+
+	retained     map[string]*storedEvent
+	history      map[string][]*storedEvent
+	historyLimit int
+	seq          uint64
 
-	idGen *SessionScopeIDGenerator
+	authorizer Authorizer
+	logger     *slog.Logger
+
+	idGen IDGenerator
 	sync.Mutex
 }
 
+// BrokerOptions configures a Broker, the zero value gives the defaults.
+type BrokerOptions struct {
+	// IDGenerator generates subscription and publication IDs, defaults to a
+	// SessionScopeIDGenerator.
+	IDGenerator IDGenerator
+	// Authorizer, if set, is asked before a SUBSCRIBE or PUBLISH is processed.
+	Authorizer Authorizer
+	// Logger defaults to discarding everything.
+	Logger        *slog.Logger
+	URIValidation URIValidationMode
+}
+
 func NewBroker() *Broker {
+	return NewBrokerWithOptions(nil)
+}
+
+func NewBrokerWithOptions(options *BrokerOptions) *Broker {
+	if options == nil {
+		options = &BrokerOptions{}
+	}
+
+	var idGen IDGenerator = &SessionScopeIDGenerator{}
+	if options.IDGenerator != nil {
+		idGen = options.IDGenerator
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = discardLogger()
+	}
+
 	return &Broker{
 		sessions:               map[uint64]*SessionDetails{},
-		subscriptionsByTopic:   make(map[string]*Subscription),
+		subscriptionsByTopic:   make(map[uriMatch]*Subscription),
 		subscriptionsBySession: make(map[uint64]map[uint64]*Subscription),
-		idGen:                  &SessionScopeIDGenerator{},
+		idGen:                  idGen,
 		prefixTree:             iradix.New[*Subscription](),
 		wcSubscriptionsByTopic: make(map[string]*Subscription),
+		retained:               make(map[string]*storedEvent),
+		history:                make(map[string][]*storedEvent),
+		allowDisclose:          true,
+		uriValidation:          options.URIValidation,
+		authorizer:             options.Authorizer,
+		logger:                 logger,
 	}
 }
 
@@ -51,52 +129,256 @@ func (b *Broker) AddSession(details *SessionDetails) error {
 	return nil
 }
 
+// RemoveSession removes the session and its subscriptions, its testaments are dropped.
 func (b *Broker) RemoveSession(id uint64) error {
+	_, err := b.RemoveSessionWithTestaments(id)
+	return err
+}
+
+// RemoveSessionWithTestaments removes the session like RemoveSession. Its testaments in the
+// destroyed scope are published on the way, the caller has to deliver the returned publications.
+func (b *Broker) RemoveSessionWithTestaments(id uint64) ([]*Publication, error) {
 	b.Lock()
 	defer b.Unlock()
 
 	subscriptions, exists := b.subscriptionsBySession[id]
 	if !exists {
-		return fmt.Errorf("broker: cannot remove session %b, it doesn't exist", id)
+		return nil, fmt.Errorf("broker: cannot remove session %b, it doesn't exist", id)
 	}
 
+	// a testament that fails to publish, e.g. because it is not authorized, is dropped
+	publications, _ := b.fireTestaments(id, TestamentScopeDestroyed)
+
 	delete(b.subscriptionsBySession, id)
-	for _, v := range subscriptions {
-		subscription, ok := b.subscriptionsByTopic[v.Topic]
-		if ok {
-			delete(subscription.Subscribers, id)
+	for _, subscription := range subscriptions {
+		b.removeSubscriber(subscription, id)
+	}
+
+	delete(b.sessions, id)
+
+	return publications, nil
+}
+
+// removeSubscriber removes the subscriber from the subscription and drops the subscription
+// once it has no subscribers left.
+func (b *Broker) removeSubscriber(subscription *Subscription, subscriberID uint64) {
+	delete(subscription.Subscribers, subscriberID)
+	if len(subscription.Subscribers) > 0 {
+		return
+	}
+
+	delete(b.subscriptionsByTopic, uriMatch{subscription.Topic, subscription.Match})
+	switch subscription.Match {
+	case MatchPrefix:
+		b.prefixTree, _, _ = b.prefixTree.Delete([]byte(subscription.Topic))
+	case MatchWildcard:
+		delete(b.wcSubscriptionsByTopic, subscription.Topic)
+	}
+}
+
+func (b *Broker) HasSubscription(topic string) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, match := range matchPolicies {
+		if _, exists := b.subscriptionsByTopic[uriMatch{topic, match}]; exists {
+			return true
 		}
+	}
 
-		if len(subscription.Subscribers) == 0 {
-			delete(b.subscriptionsByTopic, v.Topic)
+	return false
+}
+
+func (b *Broker) AutoDisclosePublisher(disclose bool) {
+	b.Lock()
+	defer b.Unlock()
+	b.details = disclose
+}
+
+// AllowDisclosePublisher sets whether publishers may disclose themselves with the
+// disclose_me publish option. When disallowed, such publications are dropped and the
+// publisher gets an ERROR if it asked for an acknowledgement. Disclosure is allowed by default.
+func (b *Broker) AllowDisclosePublisher(allow bool) {
+	b.Lock()
+	defer b.Unlock()
+	b.allowDisclose = allow
+}
+
+// EnableEventHistory keeps the last limit publications of every topic, they are
+// returned by EventHistory. A limit of zero disables the history.
+func (b *Broker) EnableEventHistory(limit int) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.historyLimit = limit
+	if limit <= 0 {
+		b.history = make(map[string][]*storedEvent)
+		return
+	}
+
+	for topic, events := range b.history {
+		if len(events) > limit {
+			b.history[topic] = events[len(events)-limit:]
 		}
+	}
+}
+
+// RetainedEvents returns the retained events matching subscription subscriptionID of
+// session sessionID, to be sent right after SUBSCRIBED when the subscriber asked for
+// them with the get_retained option.
+func (b *Broker) RetainedEvents(sessionID, subscriptionID uint64) ([]*MessageWithRecipient, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	subscription, exists := b.subscriptionsBySession[sessionID][subscriptionID]
+	if !exists {
+		return nil, fmt.Errorf("broker: session %d has no subscription %d", sessionID, subscriptionID)
+	}
+
+	var stored []*storedEvent
+	for topic, event := range b.retained {
+		if subscriptionMatches(subscription, topic) && event.filter.allows(b.sessions[sessionID]) {
+			stored = append(stored, event)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].seq < stored[j].seq })
+
+	result := make([]*MessageWithRecipient, 0, len(stored))
+	for _, event := range stored {
+		result = append(result, &MessageWithRecipient{
+			Message:   event.event(subscriptionID, map[string]any{DetailRetained: true}),
+			Recipient: sessionID,
+		})
+	}
+
+	return result, nil
+}
+
+// EventHistory returns up to limit of the most recent events, oldest first, published
+// to topics matching subscription subscriptionID that session sessionID was eligible
+// to receive. The session has to hold the subscription. A limit of zero returns all
+// events kept in the history.
+func (b *Broker) EventHistory(sessionID, subscriptionID uint64, limit int) ([]*messages.Event, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	details, exists := b.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("broker: session %d doesn't exist", sessionID)
+	}
+
+	// only subscribers may read the history, subscribing is where they are authorized
+	subscription, exists := b.subscriptionsBySession[sessionID][subscriptionID]
+	if !exists {
+		return nil, fmt.Errorf("broker: session %d is not subscribed to %d", sessionID, subscriptionID)
+	}
 
-		if subscription.Match == MatchPrefix {
-			b.prefixTree, _, _ = b.prefixTree.Delete([]byte(subscription.Topic))
+	var stored []*storedEvent
+	for topic, events := range b.history {
+		if !subscriptionMatches(subscription, topic) {
+			continue
 		}
 
-		if subscription.Match == MatchWildcard {
-			delete(b.wcSubscriptionsByTopic, v.Topic)
+		for _, event := range events {
+			if event.filter.allows(details) {
+				stored = append(stored, event)
+			}
 		}
 	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].seq < stored[j].seq })
 
-	delete(b.sessions, id)
+	if limit > 0 && len(stored) > limit {
+		stored = stored[len(stored)-limit:]
+	}
 
-	return nil
+	result := make([]*messages.Event, 0, len(stored))
+	for _, event := range stored {
+		result = append(result, event.event(subscriptionID, nil))
+	}
+
+	return result, nil
 }
 
-func (b *Broker) HasSubscription(topic string) bool {
+// store keeps the publication as retained event and in the history, must be called
+// with the lock held.
+func (b *Broker) store(publish *messages.Publish, publicationID uint64, details map[string]any,
+	filter *publishFilter) {
+	retain, _ := publish.Options()[OptRetain].(bool)
+	if !retain && b.historyLimit <= 0 {
+		return
+	}
+
+	// the publisher may later subscribe to get the retained event or history
+	storedFilter := *filter
+	storedFilter.excludeMe = false
+
+	b.seq++
+	event := &storedEvent{
+		seq:           b.seq,
+		publicationID: publicationID,
+		topic:         publish.Topic(),
+		details:       details,
+		args:          publish.Args(),
+		kwArgs:        publish.KwArgs(),
+		filter:        &storedFilter,
+	}
+
+	if retain {
+		b.retained[publish.Topic()] = event
+	}
+
+	if b.historyLimit > 0 {
+		events := append(b.history[publish.Topic()], event)
+		if len(events) > b.historyLimit {
+			events = events[len(events)-b.historyLimit:]
+		}
+		b.history[publish.Topic()] = events
+	}
+}
+
+func subscriptionMatches(subscription *Subscription, topic string) bool {
+	switch subscription.Match {
+	case MatchPrefix:
+		return strings.HasPrefix(topic, subscription.Topic)
+	case MatchWildcard:
+		return wildcardMatch(topic, subscription.Topic)
+	default:
+		return topic == subscription.Topic
+	}
+}
+
+// SetURIValidation sets how topic URIs are validated, the default is URIValidationLoose.
+func (b *Broker) SetURIValidation(mode URIValidationMode) {
 	b.Lock()
 	defer b.Unlock()
+	b.uriValidation = mode
+}
 
-	_, exists := b.subscriptionsByTopic[topic]
-	return exists
+// SetAuthorizer sets the Authorizer asked before a PUBLISH or SUBSCRIBE is processed.
+func (b *Broker) SetAuthorizer(authorizer Authorizer) {
+	b.Lock()
+	defer b.Unlock()
+	b.authorizer = authorizer
 }
 
-func (b *Broker) AutoDisclosePublisher(disclose bool) {
+// Roles returns the "broker" role with the features this broker currently supports, to
+// announce it in WELCOME, see AcceptorOptions.
+func (b *Broker) Roles() map[string]any {
 	b.Lock()
 	defer b.Unlock()
-	b.details = disclose
+
+	return map[string]any{
+		"broker": map[string]any{
+			"features": map[string]any{
+				FeaturePublisherExclusion:       true,
+				FeatureSubscriberBlackWhiteList: true,
+				FeaturePublisherIdentification:  b.allowDisclose,
+				FeaturePatternBasedSubscription: true,
+				FeatureEventRetention:           true,
+				FeatureEventHistory:             b.historyLimit > 0,
+			},
+		},
+	}
 }
 
 func (b *Broker) ReceiveMessage(sessionID uint64, msg messages.Message) (*MessageWithRecipient, error) {
@@ -111,27 +393,44 @@ func (b *Broker) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 		}
 
 		subscribe := msg.(*messages.Subscribe)
-		subscription, exists := b.subscriptionsByTopic[subscribe.Topic()]
+		match := util.ToString(subscribe.Options()[OptionMatch])
+		if !validMatch(match) {
+			err := messages.NewError(messages.MessageTypeSubscribe, subscribe.RequestID(), map[string]any{},
+				ErrInvalidArgument, []any{fmt.Sprintf("invalid match %q option", match)}, nil)
+			return &MessageWithRecipient{Message: err, Recipient: sessionID}, nil
+		}
+
+		// subscribing to the router's meta events is allowed
+		if err := validateURI(subscribe.Topic(), match, b.uriValidation, false); err != nil {
+			errMsg := messages.NewError(messages.MessageTypeSubscribe, subscribe.RequestID(), map[string]any{},
+				ErrInvalidURI, []any{err.Error()}, nil)
+			return &MessageWithRecipient{Message: errMsg, Recipient: sessionID}, nil
+		}
+
+		if uri := authorize(b.authorizer, b.logger, b.sessions[sessionID], subscribe); uri != "" {
+			errMsg := messages.NewError(messages.MessageTypeSubscribe, subscribe.RequestID(), map[string]any{},
+				uri, nil, nil)
+			return &MessageWithRecipient{Message: errMsg, Recipient: sessionID}, nil
+		}
+
+		key := uriMatch{subscribe.Topic(), normalizeMatch(match)}
+		subscription, exists := b.subscriptionsByTopic[key]
 		if exists {
 			subscription.Subscribers[sessionID] = sessionID
 		} else {
 			subscription = &Subscription{
 				ID:          b.idGen.NextID(),
 				Topic:       subscribe.Topic(),
+				Match:       key.match,
 				Subscribers: map[uint64]uint64{sessionID: sessionID},
 			}
-			match := util.ToString(subscribe.Options()[OptionMatch])
-			switch match {
+			switch key.match {
 			case MatchPrefix:
-				subscription.Match = match
 				b.prefixTree, _, _ = b.prefixTree.Insert([]byte(subscription.Topic), subscription)
 			case MatchWildcard:
-				subscription.Match = match
 				b.wcSubscriptionsByTopic[subscription.Topic] = subscription
-			default:
-				subscription.Match = MatchExact
 			}
-			b.subscriptionsByTopic[subscribe.Topic()] = subscription
+			b.subscriptionsByTopic[key] = subscription
 		}
 
 		b.subscriptionsBySession[sessionID][subscription.ID] = subscription
@@ -148,30 +447,20 @@ func (b *Broker) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 
 		subscription, exists := subscriptions[unsubscribe.SubscriptionID()]
 		if !exists {
-			return nil, fmt.Errorf("broker: cannot unsubscribe non-existent subscription %d",
+			return nil, NewProtocolViolationError("broker: cannot unsubscribe non-existent subscription %d",
 				unsubscribe.SubscriptionID())
 		}
 
-		delete(subscription.Subscribers, sessionID)
-		if len(subscription.Subscribers) == 0 {
-			delete(b.subscriptionsByTopic, subscription.Topic)
-		}
-		if subscription.Match == MatchPrefix {
-			b.prefixTree, _, _ = b.prefixTree.Delete([]byte(subscription.Topic))
-		}
-		if subscription.Match == MatchWildcard {
-			delete(b.wcSubscriptionsByTopic, subscription.Topic)
-		}
-
 		delete(b.subscriptionsBySession[sessionID], subscription.ID)
+		b.removeSubscriber(subscription, sessionID)
 
 		unsubscribed := messages.NewUnsubscribed(unsubscribe.RequestID())
 		result := &MessageWithRecipient{Message: unsubscribed, Recipient: sessionID}
 		return result, nil
 	case messages.MessageTypeError:
-		return nil, fmt.Errorf("broker: error handling is not implemented yet")
+		return nil, NewProtocolViolationError("broker: error handling is not implemented yet")
 	default:
-		return nil, fmt.Errorf("broker: received unexpected message of type %T", msg)
+		return nil, NewProtocolViolationError("broker: received unexpected message of type %T", msg)
 	}
 }
 
@@ -179,17 +468,119 @@ func (b *Broker) ReceivePublish(sessionID uint64, publish *messages.Publish) (*P
 	b.Lock()
 	defer b.Unlock()
 
-	_, exists := b.subscriptionsBySession[sessionID]
+	return b.receivePublish(sessionID, publish)
+}
+
+// AddTestament stores a testament for session sessionID, see SessionDetails.AddTestament.
+func (b *Broker) AddTestament(sessionID uint64, scope string, testament Testament) error {
+	b.Lock()
+	details, exists := b.sessions[sessionID]
+	b.Unlock()
+
+	if !exists {
+		return fmt.Errorf("broker: cannot add testament, session %d doesn't exist", sessionID)
+	}
+
+	return details.AddTestament(scope, testament)
+}
+
+// FlushTestaments removes the testaments of session sessionID in the given scope.
+func (b *Broker) FlushTestaments(sessionID uint64, scope string) (int, error) {
+	b.Lock()
+	details, exists := b.sessions[sessionID]
+	b.Unlock()
+
+	if !exists {
+		return 0, fmt.Errorf("broker: cannot flush testaments, session %d doesn't exist", sessionID)
+	}
+
+	return details.FlushTestaments(scope)
+}
+
+// FireTestaments publishes the testaments of session sessionID in the given scope on
+// behalf of the session. It must be called before the session is removed.
+func (b *Broker) FireTestaments(sessionID uint64, scope string) ([]*Publication, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.fireTestaments(sessionID, scope)
+}
+
+// fireTestaments must be called with the lock held.
+func (b *Broker) fireTestaments(sessionID uint64, scope string) ([]*Publication, error) {
+	details, exists := b.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("broker: cannot fire testaments, session %d doesn't exist", sessionID)
+	}
+
+	var publications []*Publication
+	for _, testament := range details.takeTestaments(scope) {
+		options := make(map[string]any, len(testament.Options))
+		for key, value := range testament.Options {
+			options[key] = value
+		}
+		// nobody is there to receive an acknowledgement
+		delete(options, OptAcknowledge)
+
+		publish := messages.NewPublish(0, options, testament.Topic, testament.Args, testament.KwArgs)
+		publication, err := b.receivePublish(sessionID, publish)
+		if err != nil {
+			return publications, err
+		}
+
+		publications = append(publications, publication)
+	}
+
+	return publications, nil
+}
+
+func (b *Broker) receivePublish(sessionID uint64, publish *messages.Publish) (*Publication, error) {
+	publisher, exists := b.sessions[sessionID]
 	if !exists {
 		return nil, fmt.Errorf("broker: cannot publish, session %d doesn't exist", sessionID)
 	}
 
 	result := &Publication{}
 	publicationID := b.idGen.NextID()
+	acknowledge, _ := publish.Options()[OptAcknowledge].(bool)
+
+	// errors for PUBLISH are only sent if the publisher asked for an acknowledgement
+	publishError := func(uri string, args []any) (*Publication, error) {
+		if acknowledge {
+			errMsg := messages.NewError(messages.MessageTypePublish, publish.RequestID(), map[string]any{},
+				uri, args, nil)
+			result.Ack = &MessageWithRecipient{Message: errMsg, Recipient: sessionID}
+		}
+
+		return result, nil
+	}
+
+	if err := validateURI(publish.Topic(), MatchExact, b.uriValidation, true); err != nil {
+		return publishError(ErrInvalidURI, []any{err.Error()})
+	}
+
+	if uri := authorize(b.authorizer, b.logger, publisher, publish); uri != "" {
+		return publishError(uri, nil)
+	}
+
+	discloseMe, _ := publish.Options()[OptionDiscloseMe].(bool)
+	if discloseMe && !b.allowDisclose {
+		return publishError(ErrOptionDisallowedDiscloseMe, nil)
+	}
+
+	if !filterFeaturesSupported(publisher, publish.Options()) {
+		return publishError(ErrFeatureNotSupported, nil)
+	}
+
+	filter, err := newPublishFilter(sessionID, publish.Options())
+	if err != nil {
+		return publishError(ErrInvalidArgument, []any{err.Error()})
+	}
 
 	var subscription *Subscription
-	subscription, exists = b.subscriptionsByTopic[publish.Topic()]
-	if !exists || len(subscription.Subscribers) == 0 {
+	subscription, exists = b.subscriptionsByTopic[uriMatch{publish.Topic(), MatchExact}]
+
+	if !exists {
 		if b.prefixTree.Len() > 0 {
 			_, sub, ok := b.prefixTree.Root().LongestPrefix([]byte(publish.Topic()))
 			if ok {
@@ -198,33 +589,43 @@ func (b *Broker) ReceivePublish(sessionID uint64, publish *messages.Publish) (*P
 		}
 
 		if !exists {
-			for topic, sub := range b.wcSubscriptionsByTopic {
-				if wildcardMatch(publish.Topic(), topic) {
-					subscription, exists = sub, true
-					break
-				}
-			}
+			subscription, exists = bestWildcardMatch(publish.Topic(), b.wcSubscriptionsByTopic)
 		}
 	}
+	details := map[string]any{}
+	if b.details || discloseMe {
+		details["topic"] = publish.Topic()
+		details["publisher"] = sessionID
+		details["publisher_authid"] = publisher.AuthID()
+		details["publisher_authrole"] = publisher.AuthRole()
+	}
+
+	b.store(publish, publicationID, details, filter)
+
 	if exists && len(subscription.Subscribers) > 0 {
-		details := map[string]any{}
-		if b.details {
-			publisher := b.sessions[sessionID]
-			details["topic"] = publish.Topic()
-			details["publisher"] = sessionID
-			details["publisher_authid"] = publisher.AuthID()
-			details["publisher_authrole"] = publisher.AuthRole()
+		for _, subscriber := range subscription.Subscribers {
+			if filter.allows(b.sessions[subscriber]) {
+				result.Recipients = append(result.Recipients, subscriber)
+			}
 		}
 
-		event := messages.NewEvent(subscription.ID, publicationID, details, publish.Args(), publish.KwArgs())
-		result.Event = event
-		for _, subscriber := range subscription.Subscribers {
-			result.Recipients = append(result.Recipients, subscriber)
+		if len(result.Recipients) > 0 {
+			eventDetails := details
+			// subscribers of a pattern subscription need to know which topic was published to
+			if subscription.Match != MatchExact {
+				eventDetails = make(map[string]any, len(details)+1)
+				for key, value := range details {
+					eventDetails[key] = value
+				}
+				eventDetails["topic"] = publish.Topic()
+			}
+
+			result.Event = messages.NewEvent(subscription.ID, publicationID, eventDetails, publish.Args(),
+				publish.KwArgs())
 		}
 	}
 
-	ack, ok := publish.Options()[OptAcknowledge].(bool)
-	if ok && ack {
+	if acknowledge {
 		published := messages.NewPublished(publish.RequestID(), publicationID)
 		result.Ack = &MessageWithRecipient{Message: published, Recipient: sessionID}
 	}
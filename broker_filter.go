@@ -0,0 +1,255 @@
+package wampproto
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xconnio/wampproto-go/util"
+)
+
+const (
+	OptExcludeMe         = "exclude_me"
+	OptExclude           = "exclude"
+	OptExcludeAuthID     = "exclude_authid"
+	OptExcludeAuthRole   = "exclude_authrole"
+	OptExcludeAuthExtra  = "exclude_authextra"
+	OptEligible          = "eligible"
+	OptEligibleAuthID    = "eligible_authid"
+	OptEligibleAuthRole  = "eligible_authrole"
+	OptEligibleAuthExtra = "eligible_authextra"
+)
+
+// filterFeaturesSupported reports whether the publisher negotiated the features the
+// filtering options of its PUBLISH depend on.
+func filterFeaturesSupported(publisher *SessionDetails, options map[string]any) bool {
+	if excludeMe, ok := options[OptExcludeMe].(bool); ok && !excludeMe &&
+		!publisher.HasFeature("publisher", FeaturePublisherExclusion) {
+		return false
+	}
+
+	if publisher.HasFeature("publisher", FeatureSubscriberBlackWhiteList) {
+		return true
+	}
+
+	for _, option := range []string{OptExclude, OptExcludeAuthID, OptExcludeAuthRole, OptExcludeAuthExtra,
+		OptEligible, OptEligibleAuthID, OptEligibleAuthRole, OptEligibleAuthExtra} {
+		if _, ok := options[option]; ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// publishFilter decides which subscribers receive a publication. Eligible lists that are
+// not set allow every subscriber, exclusions take precedence over eligibility.
+type publishFilter struct {
+	publisher uint64
+	excludeMe bool
+
+	exclude         map[uint64]struct{}
+	excludeAuthID   map[string]struct{}
+	excludeAuthRole map[string]struct{}
+	// a subscriber is excluded if its authextra matches all entries
+	excludeAuthExtra map[string]any
+
+	eligible         map[uint64]struct{}
+	eligibleAuthID   map[string]struct{}
+	eligibleAuthRole map[string]struct{}
+	// a subscriber is eligible if its authextra matches all entries
+	eligibleAuthExtra map[string]any
+}
+
+func newPublishFilter(publisher uint64, options map[string]any) (*publishFilter, error) {
+	filter := &publishFilter{publisher: publisher, excludeMe: true}
+
+	if excludeMe, ok := options[OptExcludeMe]; ok {
+		if filter.excludeMe, ok = excludeMe.(bool); !ok {
+			return nil, fmt.Errorf("%s must be a boolean", OptExcludeMe)
+		}
+	}
+
+	var err error
+	if filter.exclude, err = idSetOption(options, OptExclude); err != nil {
+		return nil, err
+	}
+	if filter.excludeAuthID, err = stringSetOption(options, OptExcludeAuthID); err != nil {
+		return nil, err
+	}
+	if filter.excludeAuthRole, err = stringSetOption(options, OptExcludeAuthRole); err != nil {
+		return nil, err
+	}
+	if filter.excludeAuthExtra, err = mapOption(options, OptExcludeAuthExtra); err != nil {
+		return nil, err
+	}
+	if filter.eligible, err = idSetOption(options, OptEligible); err != nil {
+		return nil, err
+	}
+	if filter.eligibleAuthID, err = stringSetOption(options, OptEligibleAuthID); err != nil {
+		return nil, err
+	}
+	if filter.eligibleAuthRole, err = stringSetOption(options, OptEligibleAuthRole); err != nil {
+		return nil, err
+	}
+	if filter.eligibleAuthExtra, err = mapOption(options, OptEligibleAuthExtra); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func (f *publishFilter) allows(details *SessionDetails) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.excludeMe && details.ID() == f.publisher {
+		return false
+	}
+
+	if _, ok := f.exclude[details.ID()]; ok {
+		return false
+	}
+	if _, ok := f.excludeAuthID[details.AuthID()]; ok {
+		return false
+	}
+	if _, ok := f.excludeAuthRole[details.AuthRole()]; ok {
+		return false
+	}
+	if f.excludeAuthExtra != nil && authExtraMatches(details.AuthExtra(), f.excludeAuthExtra) {
+		return false
+	}
+
+	if f.eligible != nil {
+		if _, ok := f.eligible[details.ID()]; !ok {
+			return false
+		}
+	}
+	if f.eligibleAuthID != nil {
+		if _, ok := f.eligibleAuthID[details.AuthID()]; !ok {
+			return false
+		}
+	}
+	if f.eligibleAuthRole != nil {
+		if _, ok := f.eligibleAuthRole[details.AuthRole()]; !ok {
+			return false
+		}
+	}
+	if f.eligibleAuthExtra != nil && !authExtraMatches(details.AuthExtra(), f.eligibleAuthExtra) {
+		return false
+	}
+
+	return true
+}
+
+// authExtraMatches reports whether authExtra has all entries of filter. A filter value
+// that is a list matches any of its elements.
+func authExtraMatches(authExtra, filter map[string]any) bool {
+	for key, expected := range filter {
+		actual, ok := authExtra[key]
+		if !ok {
+			return false
+		}
+
+		if candidates, ok := expected.([]any); ok {
+			matched := false
+			for _, candidate := range candidates {
+				if valuesEqual(actual, candidate) {
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return false
+			}
+		} else if !valuesEqual(actual, expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// valuesEqual compares numbers by value, serializers may decode them to different types.
+func valuesEqual(a, b any) bool {
+	x, aNumber := util.AsFloat64(a)
+	y, bNumber := util.AsFloat64(b)
+	if aNumber && bNumber {
+		return x == y
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func idSetOption(options map[string]any, name string) (map[uint64]struct{}, error) {
+	value, ok := options[name]
+	if !ok {
+		return nil, nil
+	}
+
+	var items []any
+	switch value := value.(type) {
+	case []any:
+		items = value
+	case []uint64:
+		for _, id := range value {
+			items = append(items, id)
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a list of session IDs", name)
+	}
+
+	set := make(map[uint64]struct{}, len(items))
+	for _, item := range items {
+		id, ok := util.AsUInt64(item)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list of session IDs", name)
+		}
+
+		set[id] = struct{}{}
+	}
+
+	return set, nil
+}
+
+func stringSetOption(options map[string]any, name string) (map[string]struct{}, error) {
+	value, ok := options[name]
+	if !ok {
+		return nil, nil
+	}
+
+	var items []string
+	switch value := value.(type) {
+	case []any:
+		var err error
+		if items, err = util.AnysToStrings(value); err != nil {
+			return nil, fmt.Errorf("%s must be a list of strings", name)
+		}
+	case []string:
+		items = value
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings", name)
+	}
+
+	set := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		set[item] = struct{}{}
+	}
+
+	return set, nil
+}
+
+func mapOption(options map[string]any, name string) (map[string]any, error) {
+	value, ok := options[name]
+	if !ok {
+		return nil, nil
+	}
+
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a dictionary", name)
+	}
+
+	return m, nil
+}
@@ -18,7 +18,8 @@ func TestBrokerAddRemoveSession(t *testing.T) {
 	})
 
 	t.Run("AddRemove", func(t *testing.T) {
-		details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+		details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
 		err := broker.AddSession(details)
 		require.NoError(t, err)
 
@@ -33,7 +34,8 @@ func TestBrokerAddRemoveSession(t *testing.T) {
 func TestBrokerPublish(t *testing.T) {
 	broker := wampproto.NewBroker()
 
-	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err := broker.AddSession(details)
 	require.NoError(t, err)
 
@@ -54,7 +56,8 @@ func TestBrokerPublish(t *testing.T) {
 	})
 
 	t.Run("WithSubscriber", func(t *testing.T) {
-		subDetails := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+		subDetails := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
 		err = broker.AddSession(subDetails)
 		require.NoError(t, err)
 
@@ -93,7 +96,8 @@ func TestBrokerPublish(t *testing.T) {
 func TestBrokerSubscribeUnsubscribe(t *testing.T) {
 	broker := wampproto.NewBroker()
 
-	subDetails := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	subDetails := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err := broker.AddSession(subDetails)
 	require.NoError(t, err)
 
@@ -109,7 +113,8 @@ func TestBrokerSubscribeUnsubscribe(t *testing.T) {
 	})
 
 	t.Run("PublishAndReceiveEvent", func(t *testing.T) {
-		pubDetails := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+		pubDetails := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
 		err = broker.AddSession(pubDetails)
 		require.NoError(t, err)
 
@@ -173,7 +178,8 @@ func TestBrokerWildcardSubscription(t *testing.T) {
 func testBrokerSubscriptionFlow(t *testing.T, matchType, topic, publishURI string) {
 	broker := wampproto.NewBroker()
 
-	subscriber := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	subscriber := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err := broker.AddSession(subscriber)
 	require.NoError(t, err)
 
@@ -192,7 +198,8 @@ func testBrokerSubscriptionFlow(t *testing.T, matchType, topic, publishURI strin
 	})
 
 	t.Run("Publish", func(t *testing.T) {
-		publisher := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+		publisher := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
 		err := broker.AddSession(publisher)
 		require.NoError(t, err)
 
@@ -204,10 +211,53 @@ func testBrokerSubscriptionFlow(t *testing.T, matchType, topic, publishURI strin
 	})
 }
 
+func TestBrokerSubscriptionMatchPolicies(t *testing.T) {
+	broker := wampproto.NewBroker()
+	for id := uint64(1); id <= 3; id++ {
+		require.NoError(t, broker.AddSession(wampproto.NewSessionDetails(id, "realm", "authid", "anonymous", "",
+			false, wampproto.DefaultRouterRoles(), nil)))
+	}
+
+	subscribe := func(sessionID uint64, match string) uint64 {
+		options := map[string]any{wampproto.OptionMatch: match}
+		result, err := broker.ReceiveMessage(sessionID, messages.NewSubscribe(sessionID, options, "net.node"))
+		require.NoError(t, err)
+		subscribed, ok := result.Message.(*messages.Subscribed)
+		require.True(t, ok)
+		return subscribed.SubscriptionID()
+	}
+
+	publish := func(topic string) *wampproto.Publication {
+		publication, err := broker.ReceivePublish(3, messages.NewPublish(1, nil, topic, nil, nil))
+		require.NoError(t, err)
+		return publication
+	}
+
+	exactID := subscribe(1, wampproto.MatchExact)
+	prefixID := subscribe(1, wampproto.MatchPrefix)
+	require.NotEqual(t, exactID, prefixID)
+	require.Equal(t, prefixID, subscribe(2, wampproto.MatchPrefix))
+
+	require.Equal(t, exactID, publish("net.node").Event.SubscriptionID())
+	require.Equal(t, prefixID, publish("net.node.status").Event.SubscriptionID())
+	require.Len(t, publish("net.node.status").Recipients, 2)
+
+	// the prefix subscription stays in place as long as it has subscribers
+	_, err := broker.ReceiveMessage(1, messages.NewUnsubscribe(4, prefixID))
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2}, publish("net.node.status").Recipients)
+
+	err = broker.RemoveSession(2)
+	require.NoError(t, err)
+	require.Empty(t, publish("net.node.status").Recipients)
+	require.True(t, broker.HasSubscription("net.node"))
+}
+
 func TestBrokerDisclosePublisherDetails(t *testing.T) {
 	broker := wampproto.NewBroker()
 
-	subDetails := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	subDetails := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err := broker.AddSession(subDetails)
 	require.NoError(t, err)
 
@@ -215,7 +265,8 @@ func TestBrokerDisclosePublisherDetails(t *testing.T) {
 	_, err = broker.ReceiveMessage(subDetails.ID(), subscribe)
 	require.NoError(t, err)
 
-	pubDetails := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	pubDetails := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err = broker.AddSession(pubDetails)
 	require.NoError(t, err)
 
@@ -244,3 +295,333 @@ func TestBrokerDisclosePublisherDetails(t *testing.T) {
 		require.Equal(t, map[string]any{}, publication.Event.Details())
 	})
 }
+
+func TestBrokerRetainedEvents(t *testing.T) {
+	broker := wampproto.NewBroker()
+	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(details))
+
+	retain := map[string]any{wampproto.OptRetain: true}
+	_, err := broker.ReceivePublish(details.ID(), messages.NewPublish(1, retain, "foo.bar", []any{1}, nil))
+	require.NoError(t, err)
+	_, err = broker.ReceivePublish(details.ID(), messages.NewPublish(2, retain, "foo.bar", []any{2}, nil))
+	require.NoError(t, err)
+	_, err = broker.ReceivePublish(details.ID(), messages.NewPublish(3, nil, "foo.bar", []any{3}, nil))
+	require.NoError(t, err)
+	_, err = broker.ReceivePublish(details.ID(), messages.NewPublish(4, retain, "foo.baz", []any{4}, nil))
+	require.NoError(t, err)
+
+	t.Run("Exact", func(t *testing.T) {
+		result, err := broker.ReceiveMessage(details.ID(), messages.NewSubscribe(5, nil, "foo.bar"))
+		require.NoError(t, err)
+		subscriptionID := result.Message.(*messages.Subscribed).SubscriptionID()
+
+		retained, err := broker.RetainedEvents(details.ID(), subscriptionID)
+		require.NoError(t, err)
+		require.Len(t, retained, 1)
+
+		event := retained[0].Message.(*messages.Event)
+		require.Equal(t, details.ID(), retained[0].Recipient)
+		require.Equal(t, subscriptionID, event.SubscriptionID())
+		require.Equal(t, []any{2}, event.Args())
+		require.Equal(t, true, event.Details()[wampproto.DetailRetained])
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		options := map[string]any{wampproto.OptionMatch: wampproto.MatchPrefix}
+		result, err := broker.ReceiveMessage(details.ID(), messages.NewSubscribe(6, options, "foo"))
+		require.NoError(t, err)
+
+		retained, err := broker.RetainedEvents(details.ID(), result.Message.(*messages.Subscribed).SubscriptionID())
+		require.NoError(t, err)
+		require.Len(t, retained, 2)
+		require.Equal(t, []any{2}, retained[0].Message.(*messages.Event).Args())
+		require.Equal(t, []any{4}, retained[1].Message.(*messages.Event).Args())
+	})
+
+	t.Run("UnknownSubscription", func(t *testing.T) {
+		_, err := broker.RetainedEvents(details.ID(), 100)
+		require.Error(t, err)
+	})
+}
+
+func TestBrokerEventHistory(t *testing.T) {
+	broker := wampproto.NewBroker()
+	broker.EnableEventHistory(2)
+	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(details))
+
+	result, err := broker.ReceiveMessage(details.ID(), messages.NewSubscribe(1, nil, "foo.bar"))
+	require.NoError(t, err)
+	subscriptionID := result.Message.(*messages.Subscribed).SubscriptionID()
+
+	for i := 0; i < 3; i++ {
+		_, err = broker.ReceivePublish(details.ID(), messages.NewPublish(uint64(i+2), nil, "foo.bar", []any{i}, nil))
+		require.NoError(t, err)
+	}
+
+	events, err := broker.EventHistory(details.ID(), subscriptionID, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, []any{1}, events[0].Args())
+	require.Equal(t, []any{2}, events[1].Args())
+
+	events, err = broker.EventHistory(details.ID(), subscriptionID, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, []any{2}, events[0].Args())
+
+	_, err = broker.EventHistory(details.ID(), 100, 0)
+	require.Error(t, err)
+
+	// other sessions can't read the history of a subscription they don't hold
+	other := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(other))
+	_, err = broker.EventHistory(other.ID(), subscriptionID, 0)
+	require.Error(t, err)
+}
+
+func TestBrokerTestaments(t *testing.T) {
+	broker := wampproto.NewBroker()
+	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(details))
+	subscriber := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(subscriber))
+
+	_, err := broker.ReceiveMessage(subscriber.ID(), messages.NewSubscribe(1, nil, "device.offline"))
+	require.NoError(t, err)
+
+	testament := wampproto.Testament{Topic: "device.offline", Args: []any{"device1"}}
+	require.NoError(t, broker.AddTestament(details.ID(), wampproto.TestamentScopeDetached, testament))
+	require.NoError(t, broker.AddTestament(details.ID(), "", testament))
+	require.Error(t, broker.AddTestament(details.ID(), "invalid", testament))
+	require.Len(t, details.Testaments(wampproto.TestamentScopeDestroyed), 1)
+
+	t.Run("Fire", func(t *testing.T) {
+		publications, err := broker.FireTestaments(details.ID(), wampproto.TestamentScopeDetached)
+		require.NoError(t, err)
+		require.Len(t, publications, 1)
+		require.Equal(t, []uint64{subscriber.ID()}, publications[0].Recipients)
+		require.Equal(t, []any{"device1"}, publications[0].Event.Args())
+		require.Nil(t, publications[0].Ack)
+
+		// testaments are fired only once
+		publications, err = broker.FireTestaments(details.ID(), wampproto.TestamentScopeDetached)
+		require.NoError(t, err)
+		require.Empty(t, publications)
+	})
+
+	t.Run("Flush", func(t *testing.T) {
+		flushed, err := broker.FlushTestaments(details.ID(), wampproto.TestamentScopeDestroyed)
+		require.NoError(t, err)
+		require.Equal(t, 1, flushed)
+
+		publications, err := broker.FireTestaments(details.ID(), wampproto.TestamentScopeDestroyed)
+		require.NoError(t, err)
+		require.Empty(t, publications)
+	})
+
+	t.Run("RemoveSession", func(t *testing.T) {
+		require.NoError(t, broker.AddTestament(details.ID(), wampproto.TestamentScopeDestroyed, testament))
+
+		publications, err := broker.RemoveSessionWithTestaments(details.ID())
+		require.NoError(t, err)
+		require.Len(t, publications, 1)
+		require.Equal(t, []uint64{subscriber.ID()}, publications[0].Recipients)
+	})
+}
+
+func TestBrokerPublishFiltering(t *testing.T) {
+	broker := wampproto.NewBroker()
+	publisher := wampproto.NewSessionDetails(1, "realm", "publisher", "backend", "", false, wampproto.DefaultRouterRoles(),
+		map[string]any{"tenant": "acme"})
+	acme := wampproto.NewSessionDetails(2, "realm", "alice", "user", "", false, wampproto.DefaultRouterRoles(),
+		map[string]any{"tenant": "acme", "tier": 1})
+	globex := wampproto.NewSessionDetails(3, "realm", "bob", "admin", "", false, wampproto.DefaultRouterRoles(),
+		map[string]any{"tenant": "globex", "tier": 2})
+
+	for i, details := range []*wampproto.SessionDetails{publisher, acme, globex} {
+		require.NoError(t, broker.AddSession(details))
+		_, err := broker.ReceiveMessage(details.ID(), messages.NewSubscribe(uint64(i+1), nil, "foo.bar"))
+		require.NoError(t, err)
+	}
+
+	recipients := func(options map[string]any) []uint64 {
+		publication, err := broker.ReceivePublish(publisher.ID(), messages.NewPublish(10, options, "foo.bar", nil, nil))
+		require.NoError(t, err)
+		return publication.Recipients
+	}
+
+	tests := []struct {
+		name     string
+		options  map[string]any
+		expected []uint64
+	}{
+		{"ExcludeMeByDefault", nil, []uint64{2, 3}},
+		{"IncludeMe", map[string]any{wampproto.OptExcludeMe: false}, []uint64{1, 2, 3}},
+		{"Exclude", map[string]any{wampproto.OptExclude: []any{2}}, []uint64{3}},
+		{"Eligible", map[string]any{wampproto.OptEligible: []any{uint64(3)}}, []uint64{3}},
+		{"ExcludeAuthID", map[string]any{wampproto.OptExcludeAuthID: []any{"bob"}}, []uint64{2}},
+		{"EligibleAuthRole", map[string]any{wampproto.OptEligibleAuthRole: []string{"admin"}}, []uint64{3}},
+		{"EligibleAuthExtra", map[string]any{
+			wampproto.OptEligibleAuthExtra: map[string]any{"tenant": "acme"},
+		}, []uint64{2}},
+		{"EligibleAuthExtraNumber", map[string]any{
+			wampproto.OptEligibleAuthExtra: map[string]any{"tier": float64(2)},
+		}, []uint64{3}},
+		{"EligibleAuthExtraList", map[string]any{
+			wampproto.OptEligibleAuthExtra: map[string]any{"tenant": []any{"acme", "globex"}},
+		}, []uint64{2, 3}},
+		{"ExcludeAuthExtra", map[string]any{
+			wampproto.OptExcludeAuthExtra: map[string]any{"tenant": "acme"},
+		}, []uint64{3}},
+		{"ExclusionWins", map[string]any{
+			wampproto.OptEligibleAuthExtra: map[string]any{"tenant": "acme"},
+			wampproto.OptExclude:           []any{2},
+		}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.ElementsMatch(t, test.expected, recipients(test.options))
+		})
+	}
+
+	t.Run("InvalidOption", func(t *testing.T) {
+		options := map[string]any{wampproto.OptAcknowledge: true, wampproto.OptEligibleAuthExtra: "acme"}
+		publication, err := broker.ReceivePublish(publisher.ID(), messages.NewPublish(11, options, "foo.bar", nil, nil))
+		require.NoError(t, err)
+		require.Nil(t, publication.Event)
+
+		errMsg, ok := publication.Ack.Message.(*messages.Error)
+		require.True(t, ok)
+		require.Equal(t, wampproto.ErrInvalidArgument, errMsg.URI())
+	})
+}
+
+func TestBrokerDiscloseMe(t *testing.T) {
+	broker := wampproto.NewBroker()
+	publisher := wampproto.NewSessionDetails(1, "realm", "alice", "user", "", false, wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(publisher))
+	subscriber := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(subscriber))
+	_, err := broker.ReceiveMessage(subscriber.ID(), messages.NewSubscribe(1, nil, "foo.bar"))
+	require.NoError(t, err)
+
+	options := map[string]any{wampproto.OptAcknowledge: true, wampproto.OptionDiscloseMe: true}
+
+	t.Run("Allowed", func(t *testing.T) {
+		publication, err := broker.ReceivePublish(publisher.ID(), messages.NewPublish(1, options, "foo.bar", nil, nil))
+		require.NoError(t, err)
+		expectedDetails := map[string]any{"publisher": uint64(1), "publisher_authid": "alice",
+			"publisher_authrole": "user", "topic": "foo.bar"}
+		require.Equal(t, expectedDetails, publication.Event.Details())
+	})
+
+	t.Run("Disallowed", func(t *testing.T) {
+		broker.AllowDisclosePublisher(false)
+		publication, err := broker.ReceivePublish(publisher.ID(), messages.NewPublish(2, options, "foo.bar", nil, nil))
+		require.NoError(t, err)
+		require.Nil(t, publication.Event)
+		require.Empty(t, publication.Recipients)
+
+		errMsg, ok := publication.Ack.Message.(*messages.Error)
+		require.True(t, ok)
+		require.Equal(t, wampproto.ErrOptionDisallowedDiscloseMe, errMsg.URI())
+		require.Equal(t, messages.MessageTypePublish, errMsg.MessageType())
+	})
+}
+
+func TestBrokerPatternSubscriptions(t *testing.T) {
+	broker := wampproto.NewBroker()
+	subscriber := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(subscriber))
+	publisher := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(publisher))
+
+	subscriptions := map[uint64]string{}
+	subscribe := func(requestID uint64, match, topic string) {
+		options := map[string]any{wampproto.OptionMatch: match}
+		result, err := broker.ReceiveMessage(subscriber.ID(), messages.NewSubscribe(requestID, options, topic))
+		require.NoError(t, err)
+		subscribed, ok := result.Message.(*messages.Subscribed)
+		require.True(t, ok)
+		subscriptions[subscribed.SubscriptionID()] = topic
+	}
+
+	subscribe(1, wampproto.MatchExact, "com.sensor.temperature")
+	subscribe(2, wampproto.MatchPrefix, "com.sensor")
+	subscribe(3, wampproto.MatchWildcard, "com..humidity")
+	subscribe(4, wampproto.MatchWildcard, "com.sensor.")
+
+	tests := []struct {
+		topic        string
+		subscription string
+	}{
+		{"com.sensor.temperature", "com.sensor.temperature"},
+		{"com.sensor.pressure", "com.sensor"},
+		{"com.device.humidity", "com..humidity"},
+	}
+
+	for i, test := range tests {
+		t.Run(test.topic, func(t *testing.T) {
+			publish := messages.NewPublish(uint64(i+1), nil, test.topic, nil, nil)
+			publication, err := broker.ReceivePublish(publisher.ID(), publish)
+			require.NoError(t, err)
+			require.Equal(t, test.subscription, subscriptions[publication.Event.SubscriptionID()])
+
+			if test.topic == test.subscription {
+				require.NotContains(t, publication.Event.Details(), "topic")
+			} else {
+				require.Equal(t, test.topic, publication.Event.Details()["topic"])
+			}
+		})
+	}
+
+	t.Run("InvalidMatch", func(t *testing.T) {
+		options := map[string]any{wampproto.OptionMatch: "regex"}
+		result, err := broker.ReceiveMessage(subscriber.ID(), messages.NewSubscribe(10, options, "foo"))
+		require.NoError(t, err)
+		errMsg, ok := result.Message.(*messages.Error)
+		require.True(t, ok)
+		require.Equal(t, wampproto.ErrInvalidArgument, errMsg.URI())
+	})
+}
+
+func TestBrokerOptions(t *testing.T) {
+	broker := wampproto.NewBrokerWithOptions(&wampproto.BrokerOptions{
+		IDGenerator:   &counterIDGenerator{},
+		Authorizer:    &testAuthorizer{denied: map[string]bool{"foo.denied": true}},
+		URIValidation: wampproto.URIValidationStrict,
+	})
+
+	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(details))
+
+	result, err := broker.ReceiveMessage(details.ID(), messages.NewSubscribe(1, nil, "foo.bar"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), result.Message.(*messages.Subscribed).SubscriptionID())
+
+	result, err = broker.ReceiveMessage(details.ID(), messages.NewSubscribe(2, nil, "foo.denied"))
+	require.NoError(t, err)
+	require.Equal(t, wampproto.ErrNotAuthorized, result.Message.(*messages.Error).URI())
+
+	result, err = broker.ReceiveMessage(details.ID(), messages.NewSubscribe(3, nil, "Foo.Bar"))
+	require.NoError(t, err)
+	require.Equal(t, wampproto.ErrInvalidURI, result.Message.(*messages.Error).URI())
+
+	options := map[string]any{wampproto.OptAcknowledge: true}
+	publication, err := broker.ReceivePublish(details.ID(), messages.NewPublish(4, options, "broken", nil, nil))
+	require.NoError(t, err)
+	require.Nil(t, publication.Event)
+	require.Equal(t, wampproto.ErrAuthorizationFailed, publication.Ack.Message.(*messages.Error).URI())
+}
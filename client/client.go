@@ -0,0 +1,451 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+)
+
+const (
+	ErrRuntimeError = "wamp.error.runtime_error"
+
+	leaveTimeout = 5 * time.Second
+)
+
+var ErrClosed = errors.New("client: connection closed") //nolint:gochecknoglobals
+
+// Error is returned by client methods when the router or the callee answered with a WAMP ERROR.
+type Error struct {
+	URI    string
+	Args   []any
+	KwArgs map[string]any
+}
+
+func (e *Error) Error() string {
+	if len(e.Args) == 0 {
+		return e.URI
+	}
+
+	return fmt.Sprintf("%s: %v", e.URI, e.Args)
+}
+
+type InvocationHandler func(ctx context.Context, invocation *messages.Invocation) ([]any, map[string]any, error)
+
+type EventHandler func(event *messages.Event)
+
+type Client struct {
+	peer       transports.Peer
+	serializer serializers.Serializer
+	session    *wampproto.Session
+	details    *wampproto.SessionDetails
+
+	requests      map[uint64]chan messages.Message
+	registrations map[uint64]InvocationHandler
+	subscriptions map[uint64]EventHandler
+	goodbye       chan *messages.GoodBye
+
+	// handlers of pending REGISTER and SUBSCRIBE requests, installed by the read loop
+	// so that messages following the acknowledgement are not missed
+	pendingRegistrations map[uint64]InvocationHandler
+	pendingSubscriptions map[uint64]EventHandler
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	sync.Mutex
+}
+
+// Connect dials the router at url, joins realm and returns a ready to use client. Supported
+// URL schemes are rs/tcp (rawsocket over TCP) and rs+unix/unix (rawsocket over a Unix socket).
+func Connect(ctx context.Context, url string, realm string, authenticator auth.ClientAuthenticator) (*Client,
+	error) {
+	network, address, err := parseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	peer, err := transports.DialRawSocket(ctx, network, address, transports.SerializerJson,
+		transports.DefaultMaxMsgSize)
+	if err != nil {
+		return nil, fmt.Errorf("client: failed to connect: %w", err)
+	}
+
+	serializer := &serializers.JSONSerializer{}
+	details, err := join(ctx, peer, realm, serializer, authenticator)
+	if err != nil {
+		_ = peer.Close()
+		return nil, err
+	}
+
+	clientCtx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		peer:          peer,
+		serializer:    serializer,
+		session:       wampproto.NewSession(serializer),
+		details:       details,
+		requests:      map[uint64]chan messages.Message{},
+		registrations: map[uint64]InvocationHandler{},
+		subscriptions: map[uint64]EventHandler{},
+		goodbye:       make(chan *messages.GoodBye, 1),
+		ctx:           clientCtx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+
+		pendingRegistrations: map[uint64]InvocationHandler{},
+		pendingSubscriptions: map[uint64]EventHandler{},
+	}
+
+	go c.readLoop()
+
+	return c, nil
+}
+
+func parseURL(rawURL string) (network, address string, err error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("client: invalid url %s: %w", rawURL, err)
+	}
+
+	switch parsed.Scheme {
+	case "rs", "tcp":
+		return "tcp", parsed.Host, nil
+	case "rs+unix", "unix":
+		return "unix", parsed.Path, nil
+	default:
+		return "", "", fmt.Errorf("client: unsupported url scheme %s", parsed.Scheme)
+	}
+}
+
+func join(ctx context.Context, peer transports.Peer, realm string, serializer serializers.Serializer,
+	authenticator auth.ClientAuthenticator) (*wampproto.SessionDetails, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = peer.NetConn().SetDeadline(deadline)
+		defer func() { _ = peer.NetConn().SetDeadline(time.Time{}) }()
+	}
+
+	joiner := wampproto.NewJoiner(realm, serializer, authenticator)
+	hello, err := joiner.SendHello()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = peer.Write(hello); err != nil {
+		return nil, fmt.Errorf("client: failed to send HELLO: %w", err)
+	}
+
+	for {
+		payload, err := peer.Read()
+		if err != nil {
+			return nil, fmt.Errorf("client: failed to join: %w", err)
+		}
+
+		toSend, err := joiner.Receive(payload)
+		if err != nil {
+			return nil, fmt.Errorf("client: failed to join: %w", err)
+		}
+
+		if toSend == nil {
+			return joiner.SessionDetails()
+		}
+
+		if err = peer.Write(toSend); err != nil {
+			return nil, fmt.Errorf("client: failed to send AUTHENTICATE: %w", err)
+		}
+	}
+}
+
+func (c *Client) SessionDetails() *wampproto.SessionDetails {
+	return c.details
+}
+
+// Done returns a channel that is closed once the connection to the router is gone.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) Call(ctx context.Context, procedure string, args []any, kwArgs map[string]any,
+	options map[string]any) (*messages.Result, error) {
+	call := c.session.NewCall(options, procedure, args, kwArgs)
+	response, err := c.request(ctx, call.RequestID(), call)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(*messages.Result), nil
+}
+
+func (c *Client) Register(ctx context.Context, procedure string, handler InvocationHandler,
+	options map[string]any) (uint64, error) {
+	register := c.session.NewRegister(options, procedure)
+	c.Lock()
+	c.pendingRegistrations[register.RequestID()] = handler
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.pendingRegistrations, register.RequestID())
+		c.Unlock()
+	}()
+
+	response, err := c.request(ctx, register.RequestID(), register)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.(*messages.Registered).RegistrationID(), nil
+}
+
+func (c *Client) Unregister(ctx context.Context, registrationID uint64) error {
+	unregister := c.session.NewUnregister(registrationID)
+	if _, err := c.request(ctx, unregister.RequestID(), unregister); err != nil {
+		return err
+	}
+
+	c.Lock()
+	delete(c.registrations, registrationID)
+	c.Unlock()
+
+	return nil
+}
+
+// Publish sends an event to topic. If the acknowledge option is set, it waits for the
+// router to confirm the publication.
+func (c *Client) Publish(ctx context.Context, topic string, args []any, kwArgs map[string]any,
+	options map[string]any) error {
+	publish := c.session.NewPublish(options, topic, args, kwArgs)
+	acknowledge, _ := publish.Options()[wampproto.OptAcknowledge].(bool)
+	if !acknowledge {
+		return c.send(publish)
+	}
+
+	_, err := c.request(ctx, publish.RequestID(), publish)
+	return err
+}
+
+func (c *Client) Subscribe(ctx context.Context, topic string, handler EventHandler,
+	options map[string]any) (uint64, error) {
+	subscribe := c.session.NewSubscribe(options, topic)
+	c.Lock()
+	c.pendingSubscriptions[subscribe.RequestID()] = handler
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.pendingSubscriptions, subscribe.RequestID())
+		c.Unlock()
+	}()
+
+	response, err := c.request(ctx, subscribe.RequestID(), subscribe)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.(*messages.Subscribed).SubscriptionID(), nil
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, subscriptionID uint64) error {
+	unsubscribe := c.session.NewUnsubscribe(subscriptionID)
+	if _, err := c.request(ctx, unsubscribe.RequestID(), unsubscribe); err != nil {
+		return err
+	}
+
+	c.Lock()
+	delete(c.subscriptions, subscriptionID)
+	c.Unlock()
+
+	return nil
+}
+
+// Leave closes the session gracefully by exchanging GOODBYE messages and then closes the connection.
+func (c *Client) Leave() error {
+	goodbye := messages.NewGoodBye(wampproto.CloseCloseRealm, nil)
+	if err := c.send(goodbye); err != nil {
+		return err
+	}
+
+	select {
+	case <-c.goodbye:
+	case <-c.done:
+	case <-time.After(leaveTimeout):
+	}
+
+	return c.Close()
+}
+
+// Close closes the underlying connection without a closing handshake.
+func (c *Client) Close() error {
+	c.cancel()
+	if err := c.peer.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) send(msg messages.Message) error {
+	data, err := c.session.SendMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	return c.peer.Write(data)
+}
+
+// request sends msg and waits for the response correlated by requestID.
+func (c *Client) request(ctx context.Context, requestID uint64, msg messages.Message) (messages.Message, error) {
+	response := make(chan messages.Message, 1)
+	c.Lock()
+	c.requests[requestID] = response
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.requests, requestID)
+		c.Unlock()
+	}()
+
+	if err := c.send(msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, ErrClosed
+	case reply := <-response:
+		if errMsg, ok := reply.(*messages.Error); ok {
+			return nil, &Error{URI: errMsg.URI(), Args: errMsg.Args(), KwArgs: errMsg.KwArgs()}
+		}
+
+		return reply, nil
+	}
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	defer c.cancel()
+	defer func() { _ = c.peer.Close() }()
+
+	for {
+		payload, err := c.peer.Read()
+		if err != nil {
+			return
+		}
+
+		msg, err := c.session.Receive(payload)
+		if err != nil {
+			return
+		}
+
+		if !c.processIncoming(msg) {
+			return
+		}
+	}
+}
+
+func (c *Client) processIncoming(msg messages.Message) bool {
+	switch msg := msg.(type) {
+	case *messages.Result:
+		progress, _ := msg.Details()[wampproto.OptionProgress].(bool)
+		if !progress {
+			c.resolve(msg.RequestID(), msg)
+		}
+	case *messages.Registered:
+		c.Lock()
+		if handler, exists := c.pendingRegistrations[msg.RequestID()]; exists {
+			c.registrations[msg.RegistrationID()] = handler
+		}
+		c.Unlock()
+		c.resolve(msg.RequestID(), msg)
+	case *messages.Unregistered:
+		c.resolve(msg.RequestID(), msg)
+	case *messages.Subscribed:
+		c.Lock()
+		if handler, exists := c.pendingSubscriptions[msg.RequestID()]; exists {
+			c.subscriptions[msg.SubscriptionID()] = handler
+		}
+		c.Unlock()
+		c.resolve(msg.RequestID(), msg)
+	case *messages.Unsubscribed:
+		c.resolve(msg.RequestID(), msg)
+	case *messages.Published:
+		c.resolve(msg.RequestID(), msg)
+	case *messages.Error:
+		c.resolve(msg.RequestID(), msg)
+	case *messages.Invocation:
+		c.Lock()
+		handler, exists := c.registrations[msg.RegistrationID()]
+		c.Unlock()
+		if exists {
+			go c.invoke(handler, msg)
+		}
+	case *messages.Event:
+		c.Lock()
+		handler, exists := c.subscriptions[msg.SubscriptionID()]
+		c.Unlock()
+		if exists {
+			go handler(msg)
+		}
+	case *messages.GoodBye:
+		// the session is closed already if this is the reply to our own GOODBYE
+		if !c.session.Closed() {
+			_ = c.send(messages.NewGoodBye(wampproto.CloseGoodByeAndOut, nil))
+		}
+
+		select {
+		case c.goodbye <- msg:
+		default:
+		}
+
+		return false
+	case *messages.Abort:
+		return false
+	}
+
+	return true
+}
+
+func (c *Client) resolve(requestID uint64, msg messages.Message) {
+	c.Lock()
+	response, exists := c.requests[requestID]
+	c.Unlock()
+
+	if exists {
+		response <- msg
+	}
+}
+
+func (c *Client) invoke(handler InvocationHandler, invocation *messages.Invocation) {
+	args, kwArgs, err := handler(c.ctx, invocation)
+	if err == nil {
+		_ = c.send(messages.NewYield(invocation.RequestID(), nil, args, kwArgs))
+		return
+	}
+
+	var wampErr *Error
+	if errors.As(err, &wampErr) {
+		_ = c.send(messages.NewError(messages.MessageTypeInvocation, invocation.RequestID(), nil, wampErr.URI,
+			wampErr.Args, wampErr.KwArgs))
+		return
+	}
+
+	_ = c.send(messages.NewError(messages.MessageTypeInvocation, invocation.RequestID(), nil, ErrRuntimeError,
+		[]any{err.Error()}, nil))
+}
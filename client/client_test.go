@@ -0,0 +1,115 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/client"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/router"
+)
+
+const testRealm = "realm1"
+
+func startTestRouter(t *testing.T, network, address string) string {
+	r := router.NewRouter()
+	_, err := r.AddRealm(testRealm)
+	require.NoError(t, err)
+
+	listener, err := net.Listen(network, address)
+	require.NoError(t, err)
+
+	server := router.NewServer(r, nil)
+	go func() { _ = server.Serve(listener) }()
+
+	t.Cleanup(func() {
+		_ = server.Close()
+		r.Close()
+	})
+
+	return listener.Addr().String()
+}
+
+func connect(t *testing.T, url string) *client.Client {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	c, err := client.Connect(ctx, url, testRealm, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func TestClientRPC(t *testing.T) {
+	address := startTestRouter(t, "tcp", "127.0.0.1:0")
+	callee := connect(t, "rs://"+address)
+	caller := connect(t, "rs://"+address)
+	ctx := context.Background()
+
+	_, err := callee.Register(ctx, "io.xconn.echo", func(_ context.Context,
+		invocation *messages.Invocation) ([]any, map[string]any, error) {
+		return invocation.Args(), invocation.KwArgs(), nil
+	}, nil)
+	require.NoError(t, err)
+
+	_, err = callee.Register(ctx, "io.xconn.fail", func(_ context.Context,
+		_ *messages.Invocation) ([]any, map[string]any, error) {
+		return nil, nil, &client.Error{URI: "io.xconn.error"}
+	}, nil)
+	require.NoError(t, err)
+
+	t.Run("Call", func(t *testing.T) {
+		result, err := caller.Call(ctx, "io.xconn.echo", []any{"hello"}, nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, []any{"hello"}, result.Args())
+	})
+
+	t.Run("CallError", func(t *testing.T) {
+		_, err := caller.Call(ctx, "io.xconn.fail", nil, nil, nil)
+		var wampErr *client.Error
+		require.True(t, errors.As(err, &wampErr))
+		require.Equal(t, "io.xconn.error", wampErr.URI)
+	})
+
+	t.Run("NoSuchProcedure", func(t *testing.T) {
+		_, err := caller.Call(ctx, "io.xconn.missing", nil, nil, nil)
+		var wampErr *client.Error
+		require.True(t, errors.As(err, &wampErr))
+		require.Equal(t, wampproto.ErrNoSuchProcedure, wampErr.URI)
+	})
+}
+
+func TestClientPubSub(t *testing.T) {
+	address := startTestRouter(t, "unix", filepath.Join(t.TempDir(), "router.sock"))
+	subscriber := connect(t, "unix://"+address)
+	publisher := connect(t, "unix://"+address)
+	ctx := context.Background()
+
+	events := make(chan *messages.Event, 1)
+	subscriptionID, err := subscriber.Subscribe(ctx, "io.xconn.topic", func(event *messages.Event) {
+		events <- event
+	}, nil)
+	require.NoError(t, err)
+
+	err = publisher.Publish(ctx, "io.xconn.topic", []any{"hello"}, nil, map[string]any{"acknowledge": true})
+	require.NoError(t, err)
+
+	select {
+	case event := <-events:
+		require.Equal(t, []any{"hello"}, event.Args())
+	case <-time.After(time.Second):
+		require.FailNow(t, "event not received")
+	}
+
+	require.NoError(t, subscriber.Unsubscribe(ctx, subscriptionID))
+	require.NoError(t, subscriber.Leave())
+	require.NoError(t, publisher.Leave())
+}
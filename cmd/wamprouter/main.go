@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/xconnio/wampproto-go/router"
+)
+
+type config struct {
+	Realms       []string `json:"realms"`
+	TCP          string   `json:"tcp"`
+	Unix         string   `json:"unix"`
+	EventHistory int      `json:"event_history"`
+}
+
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to a JSON config file")
+	realms := flag.String("realms", "", "comma separated list of realms (default realm1)")
+	tcpAddress := flag.String("tcp", "", "TCP address to listen on, e.g. 0.0.0.0:8080")
+	unixPath := flag.String("unix", "", "path of the Unix socket to listen on")
+	eventHistory := flag.Int("event-history", 0, "number of events to keep per topic for wamp.subscription.get_events")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// flags take precedence over the config file
+	if *realms != "" {
+		cfg.Realms = strings.Split(*realms, ",")
+	}
+	if *tcpAddress != "" {
+		cfg.TCP = *tcpAddress
+	}
+	if *unixPath != "" {
+		cfg.Unix = *unixPath
+	}
+	if *eventHistory != 0 {
+		cfg.EventHistory = *eventHistory
+	}
+
+	if len(cfg.Realms) == 0 {
+		cfg.Realms = []string{"realm1"}
+	}
+	if cfg.TCP == "" && cfg.Unix == "" {
+		cfg.TCP = "0.0.0.0:8080"
+	}
+
+	r := router.NewRouter()
+	for _, realm := range cfg.Realms {
+		added, err := r.AddRealm(strings.TrimSpace(realm))
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		added.EnableEventHistory(cfg.EventHistory)
+	}
+
+	server := router.NewServer(r, nil)
+	listen := func(network, address string) {
+		log.Printf("listening for rawsocket connections on %s:%s", network, address)
+		if err := server.ListenAndServe(network, address); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if cfg.TCP != "" {
+		go listen("tcp", cfg.TCP)
+	}
+	if cfg.Unix != "" {
+		go listen("unix", cfg.Unix)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	_ = server.Close()
+	r.Close()
+}
@@ -2,8 +2,8 @@ package wampproto
 
 import (
 	"fmt"
+	"log/slog"
 	"math/rand"
-	"path"
 	"sync"
 
 	"github.com/hashicorp/go-immutable-radix/v2"
@@ -17,6 +17,8 @@ const (
 	OptionProgress        = "progress"
 	OptionMatch           = "match"
 	OptionInvoke          = "invoke"
+	OptionDiscloseMe      = "disclose_me"
+	OptionDiscloseCaller  = "disclose_caller"
 
 	MatchExact    = "exact"
 	MatchPrefix   = "prefix"
@@ -34,6 +36,14 @@ const (
 	FeatureProgressiveCallResults     = "progressive_call_results"
 	FeatureCallCancelling             = "call_canceling"
 	FeaturePublisherExclusion         = "publisher_exclusion"
+	FeatureSubscriberBlackWhiteList   = "subscriber_blackwhite_listing"
+	FeatureCallerIdentification       = "caller_identification"
+	FeaturePatternBasedRegistration   = "pattern_based_registration"
+	FeatureSharedRegistration         = "shared_registration"
+	FeaturePublisherIdentification    = "publisher_identification"
+	FeaturePatternBasedSubscription   = "pattern_based_subscription"
+	FeatureEventRetention             = "event_retention"
+	FeatureEventHistory               = "event_history"
 )
 
 type PendingInvocation struct {
@@ -52,6 +62,9 @@ type Registration struct {
 	nextCallee       int
 	callees          []uint64
 	Match            string
+	// discloseCaller holds the callees that asked for the caller's identity on every
+	// invocation.
+	discloseCaller map[uint64]bool
 }
 
 type CallMap struct {
@@ -61,28 +74,66 @@ type CallMap struct {
 
 type Dealer struct {
 	sessions                   map[uint64]*SessionDetails
-	registrationsByProcedure   map[string]*Registration
+	registrationsByProcedure   map[uriMatch]*Registration
 	registrationsBySession     map[uint64]map[uint64]*Registration
 	prefixTree                 *iradix.Tree[*Registration]
 	wcRegistrationsByProcedure map[string]*Registration
 	pendingCalls               map[uint64]*PendingInvocation
 	invocationIDbyCall         map[CallMap]uint64
 	details                    bool
+	allowDisclose              bool
+	uriValidation              URIValidationMode
+	authorizer                 Authorizer
+	logger                     *slog.Logger
 
-	idGen *SessionScopeIDGenerator
+	idGen IDGenerator
 	sync.Mutex
 }
 
+// DealerOptions configures a Dealer, the zero value gives the defaults.
+type DealerOptions struct {
+	// IDGenerator generates registration and invocation IDs, defaults to a
+	// SessionScopeIDGenerator.
+	IDGenerator IDGenerator
+	// Authorizer, if set, is asked before a CALL or REGISTER is processed.
+	Authorizer Authorizer
+	// Logger defaults to discarding everything.
+	Logger        *slog.Logger
+	URIValidation URIValidationMode
+}
+
 func NewDealer() *Dealer {
+	return NewDealerWithOptions(nil)
+}
+
+func NewDealerWithOptions(options *DealerOptions) *Dealer {
+	if options == nil {
+		options = &DealerOptions{}
+	}
+
+	var idGen IDGenerator = &SessionScopeIDGenerator{}
+	if options.IDGenerator != nil {
+		idGen = options.IDGenerator
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = discardLogger()
+	}
+
 	return &Dealer{
 		sessions:                   make(map[uint64]*SessionDetails),
-		registrationsByProcedure:   make(map[string]*Registration),
+		registrationsByProcedure:   make(map[uriMatch]*Registration),
 		registrationsBySession:     make(map[uint64]map[uint64]*Registration),
 		pendingCalls:               make(map[uint64]*PendingInvocation),
 		invocationIDbyCall:         make(map[CallMap]uint64),
-		idGen:                      &SessionScopeIDGenerator{},
+		idGen:                      idGen,
 		prefixTree:                 iradix.New[*Registration](),
 		wcRegistrationsByProcedure: make(map[string]*Registration),
+		allowDisclose:              true,
+		uriValidation:              options.URIValidation,
+		authorizer:                 options.Authorizer,
+		logger:                     logger,
 	}
 }
 
@@ -101,55 +152,86 @@ func (d *Dealer) AddSession(details *SessionDetails) error {
 }
 
 func (d *Dealer) RemoveSession(id uint64) error {
+	_, err := d.RemoveSessionWithCanceledCalls(id)
+	return err
+}
+
+// RemoveSessionWithCanceledCalls removes the session like RemoveSession and returns an
+// ERROR(wamp.error.canceled) for every call still pending on the session as callee, the
+// caller has to deliver them so that the callers don't wait forever.
+func (d *Dealer) RemoveSessionWithCanceledCalls(id uint64) ([]*MessageWithRecipient, error) {
 	d.Lock()
 	defer d.Unlock()
 
 	_, exists := d.sessions[id]
 	if !exists {
-		return fmt.Errorf("cannot remove client with id %d not attached", id)
+		return nil, fmt.Errorf("cannot remove client with id %d not attached", id)
 	}
 
-	registrations := d.registrationsBySession[id]
-	for _, reg := range registrations {
-		registration, ok := d.registrationsByProcedure[reg.Procedure]
-		if !ok {
-			continue
-		}
-		delete(registration.Registrants, id)
-		if len(registration.Registrants) == 0 {
-			delete(d.registrationsByProcedure, registration.Procedure)
-		}
-		if registration.Match == MatchPrefix {
-			d.prefixTree.Delete([]byte(registration.Procedure))
-		}
+	for _, registration := range d.registrationsBySession[id] {
+		d.removeCallee(registration, id)
+	}
 
-		if registration.Match == MatchWildcard {
-			delete(d.wcRegistrationsByProcedure, registration.Procedure)
+	var canceled []*MessageWithRecipient
+	for invocationID, pending := range d.pendingCalls {
+		if pending.CallerID == id || pending.CalleeID == id {
+			d.removePendingCall(invocationID, pending)
 		}
 
-		for i, callee := range registration.callees {
-			if callee == id {
-				if len(registration.callees) == 1 {
-					registration.callees = make([]uint64, 0)
-				} else {
-					registration.callees = append(registration.callees[:i], registration.callees[i+1:]...)
-				}
-			}
+		if pending.CalleeID == id && pending.CallerID != id {
+			errMsg := messages.NewError(messages.MessageTypeCall, pending.RequestID, map[string]any{}, ErrCanceled,
+				[]any{"callee left"}, nil)
+			canceled = append(canceled, &MessageWithRecipient{Message: errMsg, Recipient: pending.CallerID})
 		}
 	}
 
 	delete(d.registrationsBySession, id)
 	delete(d.sessions, id)
 
-	return nil
+	return canceled, nil
+}
+
+// removeCallee removes the callee from the registration and drops the registration once
+// it has no callees left.
+func (d *Dealer) removeCallee(registration *Registration, calleeID uint64) {
+	delete(registration.Registrants, calleeID)
+	delete(registration.discloseCaller, calleeID)
+	for i, callee := range registration.callees {
+		if callee == calleeID {
+			registration.callees = append(registration.callees[:i], registration.callees[i+1:]...)
+			break
+		}
+	}
+
+	if len(registration.Registrants) > 0 {
+		return
+	}
+
+	delete(d.registrationsByProcedure, uriMatch{registration.Procedure, registration.Match})
+	switch registration.Match {
+	case MatchPrefix:
+		d.prefixTree, _, _ = d.prefixTree.Delete([]byte(registration.Procedure))
+	case MatchWildcard:
+		delete(d.wcRegistrationsByProcedure, registration.Procedure)
+	}
+}
+
+func (d *Dealer) removePendingCall(invocationID uint64, pending *PendingInvocation) {
+	delete(d.pendingCalls, invocationID)
+	delete(d.invocationIDbyCall, CallMap{CallerID: pending.CallerID, CallID: pending.RequestID})
 }
 
 func (d *Dealer) HasProcedure(procedure string) bool {
 	d.Lock()
 	defer d.Unlock()
 
-	reg, exists := d.registrationsByProcedure[procedure]
-	return exists && len(reg.Registrants) > 0
+	for _, match := range matchPolicies {
+		if reg, exists := d.registrationsByProcedure[uriMatch{procedure, match}]; exists && len(reg.Registrants) > 0 {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (d *Dealer) AutoDiscloseCaller(disclose bool) {
@@ -158,6 +240,68 @@ func (d *Dealer) AutoDiscloseCaller(disclose bool) {
 	d.details = disclose
 }
 
+// AllowDiscloseCaller sets whether callers may disclose themselves with the disclose_me
+// call option and callees may ask for it with the disclose_caller register option. When
+// disallowed, such requests are answered with an ERROR. Disclosure is allowed by default.
+func (d *Dealer) AllowDiscloseCaller(allow bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.allowDisclose = allow
+}
+
+// SetURIValidation sets how procedure URIs are validated, the default is URIValidationLoose.
+func (d *Dealer) SetURIValidation(mode URIValidationMode) {
+	d.Lock()
+	defer d.Unlock()
+	d.uriValidation = mode
+}
+
+// SetAuthorizer sets the Authorizer asked before a CALL or REGISTER is processed.
+func (d *Dealer) SetAuthorizer(authorizer Authorizer) {
+	d.Lock()
+	defer d.Unlock()
+	d.authorizer = authorizer
+}
+
+// AuthorizeCall asks the Authorizer whether the session may send call and returns the
+// ERROR to answer it with if not. Routers use it for procedures they serve themselves,
+// like meta procedures, as such calls never reach ReceiveMessage.
+func (d *Dealer) AuthorizeCall(sessionID uint64, call *messages.Call) (*MessageWithRecipient, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	caller, exists := d.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("cannot call procedure for non-existent session %d", sessionID)
+	}
+
+	if uri := authorize(d.authorizer, d.logger, caller, call); uri != "" {
+		callErr := messages.NewError(messages.MessageTypeCall, call.RequestID(), map[string]any{}, uri, nil, nil)
+		return &MessageWithRecipient{Message: callErr, Recipient: sessionID}, nil
+	}
+
+	return nil, nil
+}
+
+// Roles returns the "dealer" role with the features this dealer currently supports, to
+// announce it in WELCOME, see AcceptorOptions.
+func (d *Dealer) Roles() map[string]any {
+	d.Lock()
+	defer d.Unlock()
+
+	return map[string]any{
+		"dealer": map[string]any{
+			"features": map[string]any{
+				FeatureProgressiveCallInvocations: true,
+				FeatureProgressiveCallResults:     true,
+				FeatureCallerIdentification:       d.allowDisclose,
+				FeaturePatternBasedRegistration:   true,
+				FeatureSharedRegistration:         true,
+			},
+		},
+	}
+}
+
 func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*MessageWithRecipient, error) {
 	d.Lock()
 	defer d.Unlock()
@@ -165,11 +309,28 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 	switch msg.Type() {
 	case messages.MessageTypeCall:
 		call := msg.(*messages.Call)
+		if err := validateURI(call.Procedure(), MatchExact, d.uriValidation, false); err != nil {
+			callErr := messages.NewError(messages.MessageTypeCall, call.RequestID(), map[string]any{},
+				ErrInvalidURI, []any{err.Error()}, nil)
+			return &MessageWithRecipient{Message: callErr, Recipient: sessionID}, nil
+		}
+
+		caller, exists := d.sessions[sessionID]
+		if !exists {
+			return nil, fmt.Errorf("cannot call procedure for non-existent session %d", sessionID)
+		}
+
+		if uri := authorize(d.authorizer, d.logger, caller, call); uri != "" {
+			callErr := messages.NewError(messages.MessageTypeCall, call.RequestID(), map[string]any{}, uri, nil, nil)
+			return &MessageWithRecipient{Message: callErr, Recipient: sessionID}, nil
+		}
+
 		var regs *Registration
 		var found bool
 
-		regs, found = d.registrationsByProcedure[call.Procedure()]
-		if !found || len(regs.Registrants) == 0 {
+		regs, found = d.registrationsByProcedure[uriMatch{call.Procedure(), MatchExact}]
+
+		if !found {
 			if d.prefixTree.Len() > 0 {
 				_, reg, ok := d.prefixTree.Root().LongestPrefix([]byte(call.Procedure()))
 				if ok {
@@ -178,12 +339,7 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 			}
 
 			if !found {
-				for procedure, reg := range d.wcRegistrationsByProcedure {
-					if wildcardMatch(call.Procedure(), procedure) {
-						regs, found = reg, true
-						break
-					}
-				}
+				regs, found = bestWildcardMatch(call.Procedure(), d.wcRegistrationsByProcedure)
 			}
 		}
 
@@ -193,35 +349,48 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 			return &MessageWithRecipient{Message: callErr, Recipient: sessionID}, nil
 		}
 
-		var calleeID uint64
-		if len(regs.callees) > 1 {
-			switch regs.InvocationPolicy {
-			case InvokeFirst:
-				calleeID = regs.callees[0]
-			case InvokeLast:
-				calleeID = regs.callees[len(regs.callees)-1]
-			case InvokeRoundRobin:
-				if regs.nextCallee >= len(regs.callees) {
-					regs.nextCallee = 0
-				}
-				calleeID = regs.callees[regs.nextCallee]
-				regs.nextCallee++
-			case InvokeRandom:
-				idx := rand.Intn(len(regs.callees)) // #nosec
-				calleeID = regs.callees[idx]
-			default:
-				fmt.Printf("multiple callees registered with '%s' policy", InvokeSingle)
-				calleeID = regs.callees[0]
-			}
-		} else {
-			calleeID = regs.callees[0]
+		discloseMe, _ := call.Options()[OptionDiscloseMe].(bool)
+		if discloseMe && !d.allowDisclose {
+			callErr := messages.NewError(messages.MessageTypeCall, call.RequestID(), map[string]any{},
+				ErrOptionDisallowedDiscloseMe, nil, nil)
+			return &MessageWithRecipient{Message: callErr, Recipient: sessionID}, nil
 		}
 
 		receiveProgress, _ := call.Options()[OptionReceiveProgress].(bool)
 		progress, _ := call.Options()[OptionProgress].(bool)
 
-		invocationID, ok := d.invocationIDbyCall[CallMap{CallerID: sessionID, CallID: call.RequestID()}]
-		if !ok || !progress {
+		if (receiveProgress && !caller.HasFeature("caller", FeatureProgressiveCallResults)) ||
+			(progress && !caller.HasFeature("caller", FeatureProgressiveCallInvocations)) {
+			callErr := messages.NewError(messages.MessageTypeCall, call.RequestID(), map[string]any{},
+				ErrFeatureNotSupported, nil, nil)
+			return &MessageWithRecipient{Message: callErr, Recipient: sessionID}, nil
+		}
+
+		var calleeID uint64
+		callMap := CallMap{CallerID: sessionID, CallID: call.RequestID()}
+		invocationID, ok := d.invocationIDbyCall[callMap]
+		if ok {
+			pending := d.pendingCalls[invocationID]
+			if !pending.Progress {
+				return nil, NewProtocolViolationError("call: request ID %d reused while call is still pending", call.RequestID())
+			}
+
+			// continuation of a progressive call invocation goes to the same callee
+			calleeID = pending.CalleeID
+			pending.Progress = progress
+		} else {
+			calleeID = d.selectCallee(regs)
+			if callee := d.sessions[calleeID]; callee != nil {
+				if progress && !callee.HasFeature("callee", FeatureProgressiveCallInvocations) {
+					callErr := messages.NewError(messages.MessageTypeCall, call.RequestID(), map[string]any{},
+						ErrFeatureNotSupported, nil, nil)
+					return &MessageWithRecipient{Message: callErr, Recipient: sessionID}, nil
+				}
+
+				// a callee that can't yield progressive results only ever sends the final one
+				receiveProgress = receiveProgress && callee.HasFeature("callee", FeatureProgressiveCallResults)
+			}
+
 			invocationID = d.idGen.NextID()
 			d.pendingCalls[invocationID] = &PendingInvocation{
 				RequestID:       call.RequestID(),
@@ -230,7 +399,7 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 				ReceiveProgress: receiveProgress,
 				Progress:        progress,
 			}
-			d.invocationIDbyCall[CallMap{CallerID: sessionID, CallID: call.RequestID()}] = invocationID
+			d.invocationIDbyCall[callMap] = invocationID
 		}
 
 		details := map[string]any{}
@@ -242,8 +411,12 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 			details[OptionProgress] = progress
 		}
 
-		if d.details {
-			caller := d.sessions[sessionID]
+		// the callee of a pattern registration needs to know which procedure was called
+		if regs.Match != MatchExact {
+			details["procedure"] = call.Procedure()
+		}
+
+		if d.details || discloseMe || regs.discloseCaller[calleeID] {
 			details["procedure"] = call.Procedure()
 			details["caller"] = sessionID
 			details["caller_authid"] = caller.AuthID()
@@ -268,7 +441,12 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 		yield := msg.(*messages.Yield)
 		pending, exists := d.pendingCalls[yield.RequestID()]
 		if !exists {
-			return nil, fmt.Errorf("yield: not pending calls for session %d", sessionID)
+			return nil, NewProtocolViolationError("yield: not pending calls for session %d", sessionID)
+		}
+
+		if pending.CalleeID != sessionID {
+			return nil, NewProtocolViolationError("yield: invocation %d was not sent to session %d",
+				yield.RequestID(), sessionID)
 		}
 
 		progress, _ := yield.Options()[OptionProgress].(bool)
@@ -276,7 +454,7 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 		if pending.ReceiveProgress && progress {
 			details = map[string]any{OptionProgress: progress}
 		} else {
-			delete(d.pendingCalls, yield.RequestID())
+			d.removePendingCall(yield.RequestID(), pending)
 		}
 
 		var result *messages.Result
@@ -299,8 +477,34 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 			return nil, fmt.Errorf("cannot register procedure for non-existent session %d", sessionID)
 		}
 
+		discloseCaller, _ := register.Options()[OptionDiscloseCaller].(bool)
+		if discloseCaller && !d.allowDisclose {
+			err := messages.NewError(messages.MessageTypeRegister, register.RequestID(), map[string]any{},
+				ErrOptionNotAllowed, []any{"disclose_caller is not allowed"}, nil)
+			return &MessageWithRecipient{Message: err, Recipient: sessionID}, nil
+		}
+
 		invokePolicy := util.ToString(register.Options()[OptionInvoke])
-		registration, exists := d.registrationsByProcedure[register.Procedure()]
+		match := util.ToString(register.Options()[OptionMatch])
+		if !validMatch(match) || !validInvoke(invokePolicy) {
+			err := messages.NewError(messages.MessageTypeRegister, register.RequestID(), map[string]any{},
+				ErrInvalidArgument, []any{fmt.Sprintf("invalid match %q or invoke %q option", match, invokePolicy)}, nil)
+			return &MessageWithRecipient{Message: err, Recipient: sessionID}, nil
+		}
+
+		if err := validateURI(register.Procedure(), match, d.uriValidation, true); err != nil {
+			errMsg := messages.NewError(messages.MessageTypeRegister, register.RequestID(), map[string]any{},
+				ErrInvalidURI, []any{err.Error()}, nil)
+			return &MessageWithRecipient{Message: errMsg, Recipient: sessionID}, nil
+		}
+
+		if uri := authorize(d.authorizer, d.logger, d.sessions[sessionID], register); uri != "" {
+			errMsg := messages.NewError(messages.MessageTypeRegister, register.RequestID(), map[string]any{}, uri, nil, nil)
+			return &MessageWithRecipient{Message: errMsg, Recipient: sessionID}, nil
+		}
+
+		key := uriMatch{register.Procedure(), normalizeMatch(match)}
+		registration, exists := d.registrationsByProcedure[key]
 		if exists {
 			if registration.InvocationPolicy == "" || registration.InvocationPolicy == InvokeSingle ||
 				registration.InvocationPolicy != invokePolicy {
@@ -318,22 +522,23 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 				Registrants:      map[uint64]uint64{sessionID: sessionID},
 				callees:          []uint64{sessionID},
 				InvocationPolicy: invokePolicy,
+				Match:            key.match,
+				discloseCaller:   map[uint64]bool{},
 			}
 
-			match := util.ToString(register.Options()[OptionMatch])
-			switch match {
+			switch key.match {
 			case MatchPrefix:
-				registration.Match = match
 				d.prefixTree, _, _ = d.prefixTree.Insert([]byte(registration.Procedure), registration)
 			case MatchWildcard:
-				registration.Match = match
 				d.wcRegistrationsByProcedure[registration.Procedure] = registration
-			default:
-				registration.Match = MatchExact
 			}
 		}
 
-		d.registrationsByProcedure[register.Procedure()] = registration
+		if discloseCaller {
+			registration.discloseCaller[sessionID] = true
+		}
+
+		d.registrationsByProcedure[key] = registration
 		d.registrationsBySession[sessionID][registration.ID] = registration
 
 		registered := messages.NewRegistered(register.RequestID(), registration.ID)
@@ -342,48 +547,70 @@ func (d *Dealer) ReceiveMessage(sessionID uint64, msg messages.Message) (*Messag
 		unregister := msg.(*messages.Unregister)
 		registrations, exists := d.registrationsBySession[sessionID]
 		if !exists || len(registrations) == 0 {
-			return nil, fmt.Errorf("unregister: session %d has no registration %d", sessionID,
+			return nil, NewProtocolViolationError("unregister: session %d has no registration %d", sessionID,
 				unregister.RegistrationID())
 		}
 
-		registration := registrations[unregister.RegistrationID()]
-		delete(registration.Registrants, sessionID)
-
-		if len(registration.Registrants) == 0 {
-			delete(registrations, unregister.RegistrationID())
-			delete(d.registrationsByProcedure, registration.Procedure)
-			if registration.Match == MatchPrefix {
-				d.prefixTree.Delete([]byte(registration.Procedure))
-			}
-			if registration.Match == MatchWildcard {
-				delete(d.wcRegistrationsByProcedure, registration.Procedure)
-			}
+		registration, exists := registrations[unregister.RegistrationID()]
+		if !exists {
+			return nil, NewProtocolViolationError("unregister: session %d has no registration %d", sessionID,
+				unregister.RegistrationID())
 		}
 
+		delete(registrations, unregister.RegistrationID())
+		d.removeCallee(registration, sessionID)
+
 		unregistered := messages.NewUnregistered(unregister.RequestID())
 		return &MessageWithRecipient{Message: unregistered, Recipient: sessionID}, nil
 	case messages.MessageTypeError:
 		wErr := msg.(*messages.Error)
 		if wErr.MessageType() != messages.MessageTypeInvocation {
-			return nil, fmt.Errorf("dealer: only expected to receive error in response to invocation")
+			return nil, NewProtocolViolationError("dealer: only expected to receive error in response to invocation")
 		}
 
 		pending, exists := d.pendingCalls[wErr.RequestID()]
 		if !exists {
-			return nil, fmt.Errorf("dealer: no pending invocation for %d", wErr.RequestID())
+			return nil, NewProtocolViolationError("dealer: no pending invocation for %d", wErr.RequestID())
 		}
 
-		delete(d.pendingCalls, wErr.RequestID())
+		if pending.CalleeID != sessionID {
+			return nil, NewProtocolViolationError("dealer: invocation %d was not sent to session %d",
+				wErr.RequestID(), sessionID)
+		}
+
+		d.removePendingCall(wErr.RequestID(), pending)
 
 		wErr = messages.NewError(messages.MessageTypeCall, pending.RequestID, wErr.Details(), wErr.URI(),
 			wErr.Args(), wErr.KwArgs())
 		return &MessageWithRecipient{Message: wErr, Recipient: pending.CallerID}, nil
 	default:
-		return nil, fmt.Errorf("dealer: received unexpected message of type %T", msg)
+		return nil, NewProtocolViolationError("dealer: received unexpected message of type %T", msg)
 	}
 }
 
-func wildcardMatch(str, pattern string) bool {
-	matched, err := path.Match(pattern, str)
-	return err == nil && matched
+func (d *Dealer) selectCallee(regs *Registration) uint64 {
+	if len(regs.callees) == 1 {
+		return regs.callees[0]
+	}
+
+	switch regs.InvocationPolicy {
+	case InvokeFirst:
+		return regs.callees[0]
+	case InvokeLast:
+		return regs.callees[len(regs.callees)-1]
+	case InvokeRoundRobin:
+		if regs.nextCallee >= len(regs.callees) {
+			regs.nextCallee = 0
+		}
+		calleeID := regs.callees[regs.nextCallee]
+		regs.nextCallee++
+		return calleeID
+	case InvokeRandom:
+		idx := rand.Intn(len(regs.callees)) // #nosec
+		return regs.callees[idx]
+	default:
+		d.logger.Warn("multiple callees registered with single invocation policy", "procedure", regs.Procedure,
+			"callees", len(regs.callees))
+		return regs.callees[0]
+	}
 }
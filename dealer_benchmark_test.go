@@ -13,7 +13,8 @@ import (
 
 func BenchmarkDealerConcurrentRegistrations(b *testing.B) {
 	dealer := wampproto.NewDealer()
-	session := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	session := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	require.NoError(b, dealer.AddSession(session))
 
 	const proc = "io.xconn.test"
@@ -52,8 +53,10 @@ func performCall(b *testing.B, dealer *wampproto.Dealer, caller, callee *wamppro
 func BenchmarkDealerConcurrentCalls(b *testing.B) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
-	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 
 	require.NoError(b, dealer.AddSession(callee))
 	require.NoError(b, dealer.AddSession(caller))
@@ -79,8 +82,10 @@ func BenchmarkDealerConcurrentCalls(b *testing.B) {
 func BenchmarkDealerConcurrentPrefixCalls(b *testing.B) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
-	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 
 	require.NoError(b, dealer.AddSession(callee))
 	require.NoError(b, dealer.AddSession(caller))
@@ -109,8 +114,10 @@ func BenchmarkDealerConcurrentPrefixCalls(b *testing.B) {
 func BenchmarkDealerConcurrentWildcardCalls(b *testing.B) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
-	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 
 	require.NoError(b, dealer.AddSession(callee))
 	require.NoError(b, dealer.AddSession(caller))
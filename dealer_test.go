@@ -1,6 +1,8 @@
 package wampproto_test
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -18,7 +20,8 @@ func TestDealerAddRemoveSession(t *testing.T) {
 	})
 
 	t.Run("AddRemove", func(t *testing.T) {
-		details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+		details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
 		err := dealer.AddSession(details)
 		require.NoError(t, err)
 
@@ -33,7 +36,8 @@ func TestDealerAddRemoveSession(t *testing.T) {
 func TestDealerRegisterUnregister(t *testing.T) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err := dealer.AddSession(callee)
 	require.NoError(t, err)
 
@@ -71,7 +75,8 @@ func TestDealerRegisterUnregister(t *testing.T) {
 	})
 
 	t.Run("Call", func(t *testing.T) {
-		caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+		caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
 		err := dealer.AddSession(caller)
 		require.NoError(t, err)
 
@@ -85,7 +90,7 @@ func TestDealerRegisterUnregister(t *testing.T) {
 		// receive yield for invocation
 		invocation := invWithRecipient.Message.(*messages.Invocation)
 		yield := messages.NewYield(invocation.RequestID(), map[string]any{}, []any{"abc"}, nil)
-		yieldWithRecipient, err := dealer.ReceiveMessage(caller.ID(), yield)
+		yieldWithRecipient, err := dealer.ReceiveMessage(callee.ID(), yield)
 		require.NoError(t, err)
 		require.NotNil(t, yieldWithRecipient)
 		require.Equal(t, caller.ID(), yieldWithRecipient.Recipient)
@@ -104,6 +109,26 @@ func TestDealerRegisterUnregister(t *testing.T) {
 			_, err = dealer.ReceiveMessage(5, yield)
 			require.EqualError(t, err, "yield: not pending calls for session 5")
 		})
+
+		t.Run("Forged", func(t *testing.T) {
+			result, err := dealer.ReceiveMessage(caller.ID(), messages.NewCall(4, nil, "foo.bar", nil, nil))
+			require.NoError(t, err)
+			invocationID := result.Message.(*messages.Invocation).RequestID()
+
+			// only the callee the invocation went to may answer it
+			forgedYield := messages.NewYield(invocationID, nil, []any{"forged"}, nil)
+			_, err = dealer.ReceiveMessage(caller.ID(), forgedYield)
+			require.EqualError(t, err, fmt.Sprintf("yield: invocation %d was not sent to session 2", invocationID))
+
+			forgedError := messages.NewError(messages.MessageTypeInvocation, invocationID, nil, "forged", nil, nil)
+			_, err = dealer.ReceiveMessage(caller.ID(), forgedError)
+			require.EqualError(t, err, fmt.Sprintf("dealer: invocation %d was not sent to session 2", invocationID))
+
+			result, err = dealer.ReceiveMessage(callee.ID(), messages.NewYield(invocationID, nil, []any{"abc"}, nil))
+			require.NoError(t, err)
+			require.Equal(t, caller.ID(), result.Recipient)
+			require.Equal(t, []any{"abc"}, result.Message.(*messages.Result).Args())
+		})
 	})
 
 	t.Run("Unregister", func(t *testing.T) {
@@ -127,8 +152,10 @@ func TestDealerRegisterUnregister(t *testing.T) {
 func TestProgressiveCallResults(t *testing.T) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
-	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 
 	err := dealer.AddSession(callee)
 	require.NoError(t, err)
@@ -169,8 +196,10 @@ func TestProgressiveCallResults(t *testing.T) {
 func TestProgressiveCallInvocations(t *testing.T) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
-	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 
 	err := dealer.AddSession(callee)
 	require.NoError(t, err)
@@ -229,7 +258,8 @@ func TestDealerWildcardRegistration(t *testing.T) {
 func testDealerRegistrationAndCall(t *testing.T, matchType, procedure, callURI string) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err := dealer.AddSession(callee)
 	require.NoError(t, err)
 
@@ -246,7 +276,8 @@ func testDealerRegistrationAndCall(t *testing.T, matchType, procedure, callURI s
 	})
 
 	t.Run("Call", func(t *testing.T) {
-		caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+		caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
 		err := dealer.AddSession(caller)
 		require.NoError(t, err)
 
@@ -260,7 +291,7 @@ func testDealerRegistrationAndCall(t *testing.T, matchType, procedure, callURI s
 		// receive yield for invocation
 		invocation := invWithRecipient.Message.(*messages.Invocation)
 		yield := messages.NewYield(invocation.RequestID(), map[string]any{}, []any{"abc"}, nil)
-		yieldWithRecipient, err := dealer.ReceiveMessage(caller.ID(), yield)
+		yieldWithRecipient, err := dealer.ReceiveMessage(callee.ID(), yield)
 		require.NoError(t, err)
 		require.NotNil(t, yieldWithRecipient)
 		require.Equal(t, caller.ID(), yieldWithRecipient.Recipient)
@@ -271,7 +302,8 @@ func testDealerRegistrationAndCall(t *testing.T, matchType, procedure, callURI s
 func TestDealerDiscloseCallerDetails(t *testing.T) {
 	dealer := wampproto.NewDealer()
 
-	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err := dealer.AddSession(callee)
 	require.NoError(t, err)
 
@@ -279,7 +311,8 @@ func TestDealerDiscloseCallerDetails(t *testing.T) {
 	_, err = dealer.ReceiveMessage(callee.ID(), register)
 	require.NoError(t, err)
 
-	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	err = dealer.AddSession(caller)
 	require.NoError(t, err)
 
@@ -304,7 +337,7 @@ func TestDealerDiscloseCallerDetails(t *testing.T) {
 
 	t.Run("Disable", func(t *testing.T) {
 		dealer.AutoDiscloseCaller(false)
-		call := messages.NewCall(4, map[string]any{}, "foo.bar", []any{"abc"}, nil)
+		call := messages.NewCall(5, map[string]any{}, "foo.bar", []any{"abc"}, nil)
 		invWithRecipient, err := dealer.ReceiveMessage(caller.ID(), call)
 		require.NoError(t, err)
 		invocation := invWithRecipient.Message.(*messages.Invocation)
@@ -315,12 +348,15 @@ func TestDealerDiscloseCallerDetails(t *testing.T) {
 func TestDealerInvocationOptions(t *testing.T) {
 	dealer := wampproto.NewDealer()
 
-	callee1 := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
-	callee2 := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	callee1 := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	callee2 := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	require.NoError(t, dealer.AddSession(callee1))
 	require.NoError(t, dealer.AddSession(callee2))
 
-	caller := wampproto.NewSessionDetails(3, "realm", "authid", "anonymous", "", false, wampproto.RouterRoles, nil)
+	caller := wampproto.NewSessionDetails(3, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
 	require.NoError(t, dealer.AddSession(caller))
 
 	registerProcedures := func(proc, policy string) {
@@ -391,3 +427,330 @@ func TestDealerInvocationOptions(t *testing.T) {
 		require.Len(t, recipients, 2)
 	})
 }
+
+func TestDealerCallRequestIDLifecycle(t *testing.T) {
+	dealer := wampproto.NewDealer()
+
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(callee))
+	require.NoError(t, dealer.AddSession(caller))
+
+	_, err := dealer.ReceiveMessage(callee.ID(), messages.NewRegister(1, nil, "foo.bar"))
+	require.NoError(t, err)
+
+	call := messages.NewCall(1, nil, "foo.bar", nil, nil)
+	msgWithRecipient, err := dealer.ReceiveMessage(caller.ID(), call)
+	require.NoError(t, err)
+	invocation := msgWithRecipient.Message.(*messages.Invocation)
+
+	t.Run("ReuseWhilePending", func(t *testing.T) {
+		_, err := dealer.ReceiveMessage(caller.ID(), call)
+		require.EqualError(t, err, "call: request ID 1 reused while call is still pending")
+	})
+
+	t.Run("ReuseAfterResult", func(t *testing.T) {
+		yield := messages.NewYield(invocation.RequestID(), nil, nil, nil)
+		_, err := dealer.ReceiveMessage(callee.ID(), yield)
+		require.NoError(t, err)
+
+		msgWithRecipient, err := dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+		invocation = msgWithRecipient.Message.(*messages.Invocation)
+	})
+
+	t.Run("ReuseAfterError", func(t *testing.T) {
+		errMsg := messages.NewError(messages.MessageTypeInvocation, invocation.RequestID(), nil, "foo.error", nil, nil)
+		_, err := dealer.ReceiveMessage(callee.ID(), errMsg)
+		require.NoError(t, err)
+
+		_, err = dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+	})
+
+	t.Run("ReuseAfterSessionRemoval", func(t *testing.T) {
+		require.NoError(t, dealer.RemoveSession(caller.ID()))
+		require.NoError(t, dealer.AddSession(caller))
+
+		_, err := dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+	})
+
+	t.Run("CalleeRemoval", func(t *testing.T) {
+		canceled, err := dealer.RemoveSessionWithCanceledCalls(callee.ID())
+		require.NoError(t, err)
+		require.Len(t, canceled, 1)
+		require.Equal(t, caller.ID(), canceled[0].Recipient)
+
+		errMsg := canceled[0].Message.(*messages.Error)
+		require.Equal(t, messages.MessageTypeCall, errMsg.MessageType())
+		require.Equal(t, call.RequestID(), errMsg.RequestID())
+		require.Equal(t, wampproto.ErrCanceled, errMsg.URI())
+
+		// the call is no longer pending
+		_, err = dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+	})
+}
+
+func TestDealerDiscloseMe(t *testing.T) {
+	dealer := wampproto.NewDealer()
+
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(callee))
+	caller := wampproto.NewSessionDetails(2, "realm", "alice", "user", "", false, wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(caller))
+
+	_, err := dealer.ReceiveMessage(callee.ID(), messages.NewRegister(1, nil, "foo.bar"))
+	require.NoError(t, err)
+	options := map[string]any{wampproto.OptionDiscloseCaller: true}
+	_, err = dealer.ReceiveMessage(callee.ID(), messages.NewRegister(2, options, "foo.audited"))
+	require.NoError(t, err)
+
+	expectedDetails := func(procedure string) map[string]any {
+		return map[string]any{"caller": uint64(2), "caller_authid": "alice", "caller_authrole": "user",
+			"procedure": procedure}
+	}
+
+	t.Run("DiscloseMe", func(t *testing.T) {
+		call := messages.NewCall(1, map[string]any{wampproto.OptionDiscloseMe: true}, "foo.bar", nil, nil)
+		result, err := dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+		require.Equal(t, expectedDetails("foo.bar"), result.Message.(*messages.Invocation).Details())
+
+		call = messages.NewCall(2, nil, "foo.bar", nil, nil)
+		result, err = dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{}, result.Message.(*messages.Invocation).Details())
+	})
+
+	t.Run("DiscloseCaller", func(t *testing.T) {
+		call := messages.NewCall(3, nil, "foo.audited", nil, nil)
+		result, err := dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+		require.Equal(t, expectedDetails("foo.audited"), result.Message.(*messages.Invocation).Details())
+	})
+
+	t.Run("SharedRegistration", func(t *testing.T) {
+		auditor := wampproto.NewSessionDetails(3, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
+		require.NoError(t, dealer.AddSession(auditor))
+		worker := wampproto.NewSessionDetails(4, "realm", "authid", "anonymous", "", false,
+			wampproto.DefaultRouterRoles(), nil)
+		require.NoError(t, dealer.AddSession(worker))
+
+		shared := map[string]any{wampproto.OptionInvoke: wampproto.InvokeRoundRobin}
+		auditorOptions := map[string]any{wampproto.OptionInvoke: wampproto.InvokeRoundRobin,
+			wampproto.OptionDiscloseCaller: true}
+		_, err := dealer.ReceiveMessage(auditor.ID(), messages.NewRegister(1, auditorOptions, "foo.shared"))
+		require.NoError(t, err)
+		_, err = dealer.ReceiveMessage(worker.ID(), messages.NewRegister(1, shared, "foo.shared"))
+		require.NoError(t, err)
+
+		// only the callee that asked for it learns who is calling
+		for requestID, expected := range []map[string]any{expectedDetails("foo.shared"), {}} {
+			call := messages.NewCall(uint64(10+requestID), nil, "foo.shared", nil, nil)
+			result, err := dealer.ReceiveMessage(caller.ID(), call)
+			require.NoError(t, err)
+			require.Equal(t, expected, result.Message.(*messages.Invocation).Details())
+		}
+	})
+
+	t.Run("Disallowed", func(t *testing.T) {
+		dealer.AllowDiscloseCaller(false)
+
+		call := messages.NewCall(4, map[string]any{wampproto.OptionDiscloseMe: true}, "foo.bar", nil, nil)
+		result, err := dealer.ReceiveMessage(caller.ID(), call)
+		require.NoError(t, err)
+		require.Equal(t, caller.ID(), result.Recipient)
+		errMsg, ok := result.Message.(*messages.Error)
+		require.True(t, ok)
+		require.Equal(t, wampproto.ErrOptionDisallowedDiscloseMe, errMsg.URI())
+
+		result, err = dealer.ReceiveMessage(callee.ID(), messages.NewRegister(3, options, "foo.other"))
+		require.NoError(t, err)
+		errMsg, ok = result.Message.(*messages.Error)
+		require.True(t, ok)
+		require.Equal(t, wampproto.ErrOptionNotAllowed, errMsg.URI())
+	})
+}
+
+func TestDealerPatternRegistrations(t *testing.T) {
+	dealer := wampproto.NewDealer()
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(callee))
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(caller))
+
+	registrations := map[uint64]string{}
+	register := func(requestID uint64, match, procedure string) uint64 {
+		options := map[string]any{wampproto.OptionMatch: match}
+		result, err := dealer.ReceiveMessage(callee.ID(), messages.NewRegister(requestID, options, procedure))
+		require.NoError(t, err)
+		registered, ok := result.Message.(*messages.Registered)
+		require.True(t, ok)
+		registrations[registered.RegistrationID()] = match + " " + procedure
+		return registered.RegistrationID()
+	}
+
+	register(1, wampproto.MatchExact, "com.user.create")
+	register(2, wampproto.MatchPrefix, "com.user")
+	register(3, wampproto.MatchPrefix, "com.user.profile")
+	register(4, wampproto.MatchWildcard, "com..update")
+	register(5, wampproto.MatchWildcard, "com.user.")
+	register(6, wampproto.MatchWildcard, "com.user.update")
+
+	tests := []struct {
+		procedure    string
+		registration string
+	}{
+		{"com.user.create", "exact com.user.create"},
+		{"com.user.profile.get", "prefix com.user.profile"},
+		{"com.user.delete", "prefix com.user"},
+		{"com.device.update", "wildcard com..update"},
+		// prefix registrations take precedence over wildcard registrations
+		{"com.user.update", "prefix com.user"},
+	}
+
+	for i, test := range tests {
+		t.Run(test.procedure, func(t *testing.T) {
+			call := messages.NewCall(uint64(i+1), nil, test.procedure, nil, nil)
+			result, err := dealer.ReceiveMessage(caller.ID(), call)
+			require.NoError(t, err)
+
+			invocation := result.Message.(*messages.Invocation)
+			require.Equal(t, test.registration, registrations[invocation.RegistrationID()])
+			if strings.HasPrefix(test.registration, wampproto.MatchExact) {
+				require.NotContains(t, invocation.Details(), "procedure")
+			} else {
+				require.Equal(t, test.procedure, invocation.Details()["procedure"])
+			}
+		})
+	}
+
+	call := func(requestID uint64, procedure string) messages.Message {
+		result, err := dealer.ReceiveMessage(caller.ID(), messages.NewCall(requestID, nil, procedure, nil, nil))
+		require.NoError(t, err)
+		return result.Message
+	}
+
+	t.Run("WildcardPrecedence", func(t *testing.T) {
+		// both match, the pattern with more literal characters wins regardless of map order
+		register(7, wampproto.MatchWildcard, "org..update")
+		register(8, wampproto.MatchWildcard, "org.user.")
+
+		for i := 0; i < 10; i++ {
+			call := messages.NewCall(uint64(100+i), nil, "org.user.update", nil, nil)
+			result, err := dealer.ReceiveMessage(caller.ID(), call)
+			require.NoError(t, err)
+			invocation := result.Message.(*messages.Invocation)
+			require.Equal(t, "wildcard org..update", registrations[invocation.RegistrationID()])
+		}
+	})
+
+	t.Run("SameURI", func(t *testing.T) {
+		exactID := register(9, wampproto.MatchExact, "net.node")
+		prefixID := register(10, wampproto.MatchPrefix, "net.node")
+		require.NotEqual(t, exactID, prefixID)
+
+		require.Equal(t, exactID, call(200, "net.node").(*messages.Invocation).RegistrationID())
+		require.Equal(t, prefixID, call(201, "net.node.status").(*messages.Invocation).RegistrationID())
+
+		_, err := dealer.ReceiveMessage(callee.ID(), messages.NewUnregister(11, exactID))
+		require.NoError(t, err)
+		require.Equal(t, prefixID, call(202, "net.node").(*messages.Invocation).RegistrationID())
+
+		_, err = dealer.ReceiveMessage(callee.ID(), messages.NewUnregister(12, prefixID))
+		require.NoError(t, err)
+		require.False(t, dealer.HasProcedure("net.node"))
+		errMsg, ok := call(203, "net.node.status").(*messages.Error)
+		require.True(t, ok)
+		require.Equal(t, wampproto.ErrNoSuchProcedure, errMsg.URI())
+	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for i, options := range []map[string]any{
+			{wampproto.OptionMatch: "regex"},
+			{wampproto.OptionInvoke: "fastest"},
+		} {
+			result, err := dealer.ReceiveMessage(callee.ID(), messages.NewRegister(uint64(20+i), options, "foo.bar"))
+			require.NoError(t, err)
+			errMsg, ok := result.Message.(*messages.Error)
+			require.True(t, ok)
+			require.Equal(t, wampproto.ErrInvalidArgument, errMsg.URI())
+		}
+	})
+}
+
+type testAuthorizer struct {
+	denied map[string]bool
+}
+
+func (a *testAuthorizer) Authorize(session *wampproto.SessionDetails, msg messages.Message) (bool, error) {
+	var uri string
+	switch msg := msg.(type) {
+	case *messages.Call:
+		uri = msg.Procedure()
+	case *messages.Register:
+		uri = msg.Procedure()
+	case *messages.Publish:
+		uri = msg.Topic()
+	case *messages.Subscribe:
+		uri = msg.Topic()
+	}
+
+	if uri == "broken" {
+		return false, fmt.Errorf("authorizer unavailable for session %d", session.ID())
+	}
+
+	return !a.denied[uri], nil
+}
+
+type counterIDGenerator struct {
+	next uint64
+}
+
+func (c *counterIDGenerator) NextID() uint64 {
+	c.next += 10
+	return c.next
+}
+
+func TestDealerOptions(t *testing.T) {
+	dealer := wampproto.NewDealerWithOptions(&wampproto.DealerOptions{
+		IDGenerator: &counterIDGenerator{},
+		Authorizer:  &testAuthorizer{denied: map[string]bool{"foo.denied": true}},
+	})
+
+	callee := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(callee))
+	caller := wampproto.NewSessionDetails(2, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(caller))
+
+	result, err := dealer.ReceiveMessage(callee.ID(), messages.NewRegister(1, nil, "foo.bar"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), result.Message.(*messages.Registered).RegistrationID())
+
+	for uri, expected := range map[string]string{
+		"foo.denied": wampproto.ErrNotAuthorized,
+		"broken":     wampproto.ErrAuthorizationFailed,
+	} {
+		result, err = dealer.ReceiveMessage(callee.ID(), messages.NewRegister(2, nil, uri))
+		require.NoError(t, err)
+		require.Equal(t, expected, result.Message.(*messages.Error).URI())
+
+		result, err = dealer.ReceiveMessage(caller.ID(), messages.NewCall(3, nil, uri, nil, nil))
+		require.NoError(t, err)
+		require.Equal(t, expected, result.Message.(*messages.Error).URI())
+	}
+
+	result, err = dealer.ReceiveMessage(caller.ID(), messages.NewCall(4, nil, "foo.bar", nil, nil))
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), result.Message.(*messages.Invocation).RequestID())
+}
@@ -0,0 +1,45 @@
+package wampproto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xconnio/wampproto-go/messages"
+)
+
+// ProtocolViolationError is returned when a peer sent a message that is invalid or not
+// expected in the current state. Per the WAMP spec, the session of such a peer must be
+// closed with an ABORT carrying wamp.error.protocol_violation.
+type ProtocolViolationError struct {
+	err error
+}
+
+func NewProtocolViolationError(format string, args ...any) *ProtocolViolationError {
+	return &ProtocolViolationError{err: fmt.Errorf(format, args...)}
+}
+
+func (p *ProtocolViolationError) Error() string {
+	return p.err.Error()
+}
+
+func (p *ProtocolViolationError) Unwrap() error {
+	return errors.Unwrap(p.err)
+}
+
+// IsProtocolViolation reports whether err or any error it wraps is a ProtocolViolationError.
+func IsProtocolViolation(err error) bool {
+	var protocolViolation *ProtocolViolationError
+	return errors.As(err, &protocolViolation)
+}
+
+// NewAbortFromError returns the ABORT message to close a session with after err was
+// returned while processing a message of the peer, or nil if err is not a protocol
+// violation.
+func NewAbortFromError(err error) *messages.Abort {
+	var protocolViolation *ProtocolViolationError
+	if !errors.As(err, &protocolViolation) {
+		return nil
+	}
+
+	return messages.NewAbort(map[string]any{}, ErrProtocolViolation, []any{protocolViolation.Error()}, nil)
+}
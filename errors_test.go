@@ -0,0 +1,52 @@
+package wampproto_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/messages"
+)
+
+func TestProtocolViolationError(t *testing.T) {
+	cause := errors.New("cause")
+	err := wampproto.NewProtocolViolationError("invalid message: %w", cause)
+	require.EqualError(t, err, "invalid message: cause")
+	require.True(t, errors.Is(err, cause))
+	require.True(t, wampproto.IsProtocolViolation(fmt.Errorf("wrapped: %w", err)))
+	require.False(t, wampproto.IsProtocolViolation(cause))
+}
+
+func TestNewAbortFromError(t *testing.T) {
+	t.Run("ProtocolViolation", func(t *testing.T) {
+		abort := wampproto.NewAbortFromError(wampproto.NewProtocolViolationError("bad message"))
+		require.NotNil(t, abort)
+		require.Equal(t, wampproto.ErrProtocolViolation, abort.Reason())
+		require.Equal(t, []any{"bad message"}, abort.Args())
+	})
+
+	t.Run("OtherError", func(t *testing.T) {
+		require.Nil(t, wampproto.NewAbortFromError(errors.New("internal")))
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		session := wampproto.NewSession(nil)
+		_, err := session.ReceiveMessage(messages.NewResult(1, nil, nil, nil))
+		require.True(t, wampproto.IsProtocolViolation(err))
+	})
+
+	t.Run("Dealer", func(t *testing.T) {
+		dealer := wampproto.NewDealer()
+		_, err := dealer.ReceiveMessage(1, messages.NewYield(1, nil, nil, nil))
+		require.True(t, wampproto.IsProtocolViolation(err))
+	})
+
+	t.Run("Broker", func(t *testing.T) {
+		broker := wampproto.NewBroker()
+		_, err := broker.ReceiveMessage(1, messages.NewYield(1, nil, nil, nil))
+		require.True(t, wampproto.IsProtocolViolation(err))
+	})
+}
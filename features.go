@@ -0,0 +1,42 @@
+package wampproto
+
+// peerRoles maps each client role to the router role that serves it.
+var peerRoles = map[string]string{ //nolint:gochecknoglobals
+	"caller":     "dealer",
+	"callee":     "dealer",
+	"publisher":  "broker",
+	"subscriber": "broker",
+}
+
+// NegotiateFeatures returns, for every client role in clientRoles, the features that both the
+// client and the router announced for it. Roles are in the format of the "roles" details of
+// HELLO and WELCOME, a feature counts as announced only if its value is true.
+func NegotiateFeatures(clientRoles, routerRoles map[string]any) map[string]map[string]bool {
+	negotiated := make(map[string]map[string]bool, len(clientRoles))
+	for role := range clientRoles {
+		peer, ok := peerRoles[role]
+		if !ok {
+			continue
+		}
+
+		features := make(map[string]bool)
+		routerFeatures := roleFeatures(routerRoles, peer)
+		for feature, enabled := range roleFeatures(clientRoles, role) {
+			if supported, _ := enabled.(bool); supported {
+				if supported, _ = routerFeatures[feature].(bool); supported {
+					features[feature] = true
+				}
+			}
+		}
+
+		negotiated[role] = features
+	}
+
+	return negotiated
+}
+
+func roleFeatures(roles map[string]any, role string) map[string]any {
+	details, _ := roles[role].(map[string]any)
+	features, _ := details["features"].(map[string]any)
+	return features
+}
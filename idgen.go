@@ -38,3 +38,15 @@ func (s *SessionScopeIDGenerator) NextID() uint64 {
 	s.id++
 	return s.id
 }
+
+// IDGenerator generates the IDs of sessions, requests and publications.
+type IDGenerator interface {
+	NextID() uint64
+}
+
+// RandomIDGenerator generates IDs from the global scope, see GenerateID.
+type RandomIDGenerator struct{}
+
+func (RandomIDGenerator) NextID() uint64 {
+	return GenerateID()
+}
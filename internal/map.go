@@ -19,6 +19,11 @@ func (m *Map[K, V]) Load(key K) (value V, ok bool) {
 	return v.(V), ok
 }
 
+func (m *Map[K, V]) Exists(key K) bool {
+	_, ok := m.m.Load(key)
+	return ok
+}
+
 func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
 	v, loaded := m.m.LoadAndDelete(key)
 	if !loaded {
@@ -30,6 +30,14 @@ func TestMapLoad(t *testing.T) {
 	require.False(t, ok)
 }
 
+func TestMapExists(t *testing.T) {
+	m := &internal.Map[string, int]{}
+	m.Store("key1", 100)
+
+	require.True(t, m.Exists("key1"))
+	require.False(t, m.Exists("key2"))
+}
+
 func TestMapLoadAndDelete(t *testing.T) {
 	m := &internal.Map[string, int]{}
 	m.Store("key1", 100)
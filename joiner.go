@@ -3,6 +3,7 @@ package wampproto
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 
 	"github.com/xconnio/wampproto-go/auth"
@@ -10,27 +11,50 @@ import (
 	"github.com/xconnio/wampproto-go/serializers"
 )
 
-var ClientRoles = map[string]any{ //nolint:gochecknoglobals
-	"caller": map[string]any{
-		"features": map[string]any{
-			FeatureProgressiveCallInvocations: true,
+// ClientRoles are the roles announced by a Joiner created without JoinerOptions.Roles in
+// versions that shared them between all joiners.
+//
+// Deprecated: changing it has no effect, set JoinerOptions.Roles instead.
+var ClientRoles = DefaultClientRoles() //nolint:gochecknoglobals
+
+// DefaultClientRoles returns the roles a Joiner announces unless JoinerOptions.Roles is set.
+// Every call returns a new map that may be modified freely.
+func DefaultClientRoles() map[string]any {
+	return map[string]any{
+		"caller": map[string]any{
+			"features": map[string]any{
+				FeatureProgressiveCallInvocations: true,
+				FeatureProgressiveCallResults:     true,
+			},
+		},
+		"callee": map[string]any{
+			"features": map[string]any{
+				FeatureProgressiveCallInvocations: true,
+				FeatureProgressiveCallResults:     true,
+				FeatureCallCancelling:             true,
+			},
 		},
-	},
-	"callee": map[string]any{
-		"features": map[string]any{
-			FeatureProgressiveCallInvocations: true,
-			FeatureProgressiveCallResults:     true,
-			FeatureCallCancelling:             true,
+		"publisher": map[string]any{
+			"features": map[string]any{
+				FeaturePublisherExclusion:       true,
+				FeatureSubscriberBlackWhiteList: true,
+			},
 		},
-	},
-	"publisher": map[string]any{
-		"features": map[string]any{
-			FeaturePublisherExclusion: true,
+		"subscriber": map[string]any{
+			"features": map[string]any{},
 		},
-	},
-	"subscriber": map[string]any{
-		"features": map[string]any{},
-	},
+	}
+}
+
+// JoinerOptions configures a Joiner, the zero value gives the defaults.
+type JoinerOptions struct {
+	// Roles announced in HELLO, defaults to DefaultClientRoles.
+	Roles map[string]any
+	// Logger defaults to discarding everything.
+	Logger *slog.Logger
+	// MaxPayloadSize, if positive, is the size in bytes of the largest message Receive
+	// accepts.
+	MaxPayloadSize int
 }
 
 type joinerState uint
@@ -47,11 +71,35 @@ type Joiner struct {
 	realm         string
 	authenticator auth.ClientAuthenticator
 	serializer    serializers.Serializer
+	resumable     bool
+	resumeToken   string
+	roles         map[string]any
+	logger        *slog.Logger
+	maxPayload    int
 
 	sessionDetails *SessionDetails
 }
 
 func NewJoiner(realm string, serializer serializers.Serializer, authenticator auth.ClientAuthenticator) *Joiner {
+	return NewJoinerWithOptions(realm, serializer, authenticator, nil)
+}
+
+func NewJoinerWithOptions(realm string, serializer serializers.Serializer, authenticator auth.ClientAuthenticator,
+	options *JoinerOptions) *Joiner {
+	if options == nil {
+		options = &JoinerOptions{}
+	}
+
+	roles := options.Roles
+	if roles == nil {
+		roles = DefaultClientRoles()
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = discardLogger()
+	}
+
 	if serializer == nil {
 		serializer = &serializers.JSONSerializer{}
 	}
@@ -65,15 +113,46 @@ func NewJoiner(realm string, serializer serializers.Serializer, authenticator au
 		realm:         realm,
 		serializer:    serializer,
 		authenticator: authenticator,
+		roles:         roles,
+		logger:        logger,
+		maxPayload:    options.MaxPayloadSize,
 	}
 }
 
+// SetResumable asks the router for a resume token, see SessionDetails.ResumeToken.
+func (j *Joiner) SetResumable(resumable bool) {
+	j.resumable = resumable
+}
+
+// SetResumeToken asks the router to resume the session the token was issued for. Whether
+// that succeeded is reported by SessionDetails.Resumed; if it did, the router still has the
+// registrations and subscriptions of the session and replays the messages buffered while
+// the client was disconnected.
+func (j *Joiner) SetResumeToken(token string) {
+	j.resumeToken = token
+}
+
 func (j *Joiner) SendHello() ([]byte, error) {
+	authExtra := j.authenticator.AuthExtra()
+	if j.resumable || j.resumeToken != "" {
+		extra := make(map[string]any, len(authExtra)+2)
+		for key, value := range authExtra {
+			extra[key] = value
+		}
+
+		extra[OptionResumable] = true
+		if j.resumeToken != "" {
+			extra[OptionResumeToken] = j.resumeToken
+		}
+
+		authExtra = extra
+	}
+
 	hello := messages.NewHello(
 		j.realm,
 		j.authenticator.AuthID(),
-		j.authenticator.AuthExtra(),
-		ClientRoles,
+		authExtra,
+		j.roles,
 		[]string{j.authenticator.AuthMethod()},
 	)
 
@@ -87,9 +166,14 @@ func (j *Joiner) SendHello() ([]byte, error) {
 }
 
 func (j *Joiner) Receive(data []byte) ([]byte, error) {
+	if j.maxPayload > 0 && len(data) > j.maxPayload {
+		return nil, NewProtocolViolationError("message of %d bytes exceeds the maximum payload size of %d",
+			len(data), j.maxPayload)
+	}
+
 	msg, err := j.serializer.Deserialize(data)
 	if err != nil {
-		return nil, fmt.Errorf("joiner: failed to deserialize: %w", err)
+		return nil, NewProtocolViolationError("joiner: failed to deserialize: %w", err)
 	}
 
 	msg, err = j.ReceiveMessage(msg)
@@ -116,20 +200,31 @@ func (j *Joiner) Receive(data []byte) ([]byte, error) {
 func (j *Joiner) ReceiveMessage(msg messages.Message) (messages.Message, error) {
 	if msg.Type() == messages.MessageTypeWelcome {
 		if j.state != joinerStateHelloSent && j.state != joinerStateAuthenticateSent {
-			return nil, errors.New("received WELCOME when it was not expected")
+			return nil, NewProtocolViolationError("received WELCOME when it was not expected")
 		}
 
 		welcome := msg.(*messages.Welcome)
 		roles, _ := welcome.Details()["roles"].(map[string]any)
 		authMethod, _ := welcome.Details()["authmethod"].(string)
+		authExtra, _ := welcome.Details()["authextra"].(map[string]any)
+		if verifier, ok := j.authenticator.(auth.WelcomeVerifier); ok {
+			if err := verifier.VerifyWelcome(authExtra); err != nil {
+				return nil, err
+			}
+		}
+
 		j.sessionDetails = NewSessionDetails(welcome.SessionID(), j.realm, welcome.Details()["authid"].(string),
-			welcome.Details()["authrole"].(string), authMethod, j.serializer.Static(), roles, nil)
+			welcome.Details()["authrole"].(string), authMethod, j.serializer.Static(), roles, authExtra)
+		j.sessionDetails.authProvider, _ = welcome.Details()["authprovider"].(string)
+		j.sessionDetails.resumeToken, _ = welcome.Details()[OptionResumeToken].(string)
+		j.sessionDetails.resumed, _ = welcome.Details()[OptionResumed].(bool)
+		j.sessionDetails.features = NegotiateFeatures(j.roles, roles)
 		j.state = joinerStateJoined
 
 		return nil, nil
 	} else if msg.Type() == messages.MessageTypeChallenge {
 		if j.state != joinerStateHelloSent {
-			return nil, errors.New("received CHALLENGE when it was not expected")
+			return nil, NewProtocolViolationError("received CHALLENGE when it was not expected")
 		}
 
 		challenge := msg.(*messages.Challenge)
@@ -142,6 +237,7 @@ func (j *Joiner) ReceiveMessage(msg messages.Message) (messages.Message, error)
 		return authenticate, nil
 	} else if msg.Type() == messages.MessageTypeAbort {
 		abort := msg.(*messages.Abort)
+		j.logger.Debug("join aborted", "realm", j.realm, "reason", abort.Reason())
 
 		errStr := abort.Reason()
 		if len(abort.Args()) > 0 {
@@ -161,7 +257,7 @@ func (j *Joiner) ReceiveMessage(msg messages.Message) (messages.Message, error)
 
 		return nil, errors.New(errStr)
 	} else {
-		return nil, errors.New("received unknown message")
+		return nil, NewProtocolViolationError("received unknown message")
 	}
 }
 
@@ -1,8 +1,12 @@
 package wampproto_test
 
 import (
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -22,14 +26,16 @@ const (
 )
 
 type Authenticator struct {
+	scramCredentials map[string]*auth.SCRAMCredential
 }
 
 func NewAuthenticator() *Authenticator {
-	return &Authenticator{}
+	return &Authenticator{scramCredentials: map[string]*auth.SCRAMCredential{}}
 }
 
 func (a *Authenticator) Methods() []auth.Method {
-	return []auth.Method{auth.MethodAnonymous, auth.MethodTicket, auth.MethodCRA, auth.MethodCryptoSign}
+	return []auth.Method{auth.MethodAnonymous, auth.MethodTicket, auth.MethodCRA, auth.MethodCryptoSign,
+		auth.MethodSCRAM}
 }
 
 func (a *Authenticator) Authenticate(request auth.Request) (auth.Response, error) {
@@ -71,6 +77,25 @@ func (a *Authenticator) Authenticate(request auth.Request) (auth.Response, error
 
 		return nil, fmt.Errorf("unknown publickey")
 
+	case auth.MethodSCRAM:
+		if request.Realm() != realm || request.AuthID() != authID {
+			return nil, fmt.Errorf("unknown authid")
+		}
+
+		// a real server would load the credential from its user database
+		kdf, _ := request.AuthExtra()["test_kdf"].(string)
+		credential, ok := a.scramCredentials[kdf]
+		if !ok {
+			var err error
+			credential, err = auth.NewSCRAMCredential(secret, kdf, 1, 64)
+			if err != nil {
+				return nil, err
+			}
+			a.scramCredentials[kdf] = credential
+		}
+
+		return auth.NewSCRAMResponse(request.AuthID(), "anonymous", credential, 0), nil
+
 	default:
 		return nil, fmt.Errorf("unknown authentication method: %v", request.AuthMethod())
 	}
@@ -123,9 +148,14 @@ func TestAnonymousAuth(t *testing.T) {
 }
 
 func testAuth(t *testing.T, clientAuthenticator auth.ClientAuthenticator, serializer serializers.Serializer) error {
+	return testAuthWithOptions(t, clientAuthenticator, serializer, nil)
+}
+
+func testAuthWithOptions(t *testing.T, clientAuthenticator auth.ClientAuthenticator, serializer serializers.Serializer,
+	options *wampproto.AcceptorOptions) error {
 	var authenticator = NewAuthenticator()
 	joiner := wampproto.NewJoiner(realm, serializer, clientAuthenticator)
-	acceptor := wampproto.NewAcceptor(serializer, authenticator)
+	acceptor := wampproto.NewAcceptorWithOptions(serializer, authenticator, options)
 
 	hello, err := joiner.SendHello()
 	require.NoError(t, err)
@@ -242,6 +272,62 @@ func TestCRAAuth(t *testing.T) {
 	})
 }
 
+func TestSCRAMAuth(t *testing.T) {
+	for _, kdf := range []string{auth.SCRAMKDFArgon2, auth.SCRAMKDFPBKDF2} {
+		t.Run(kdf, func(t *testing.T) {
+			for name, serializer := range map[string]serializers.Serializer{
+				"JSONSerializer":    &serializers.JSONSerializer{},
+				"CBORSerializer":    &serializers.CBORSerializer{},
+				"MsgPackSerializer": &serializers.MsgPackSerializer{},
+			} {
+				scramAuthenticator, err := auth.NewSCRAMAuthenticator(authID, secret, map[string]any{"test_kdf": kdf})
+				require.NoError(t, err)
+				require.NoError(t, testAuth(t, scramAuthenticator, serializer), name)
+			}
+		})
+	}
+
+	t.Run("InvalidSecret", func(t *testing.T) {
+		scramAuthenticator, err := auth.NewSCRAMAuthenticator(authID, "abc",
+			map[string]any{"test_kdf": auth.SCRAMKDFPBKDF2})
+		require.NoError(t, err)
+		err = testAuth(t, scramAuthenticator, &serializers.JSONSerializer{})
+		require.EqualError(t, err, "wamp.error.authentication_failed")
+	})
+
+	t.Run("InvalidAuthID", func(t *testing.T) {
+		scramAuthenticator, err := auth.NewSCRAMAuthenticator("abc", secret, nil)
+		require.NoError(t, err)
+		err = testAuth(t, scramAuthenticator, &serializers.JSONSerializer{})
+		require.EqualError(t, err, "wamp.error.authentication_failed")
+	})
+
+	t.Run("ForgedServerSignature", func(t *testing.T) {
+		scramAuthenticator, err := auth.NewSCRAMAuthenticator(authID, secret,
+			map[string]any{"test_kdf": auth.SCRAMKDFPBKDF2})
+		require.NoError(t, err)
+		serializer := &serializers.JSONSerializer{}
+		joiner := wampproto.NewJoiner(realm, serializer, scramAuthenticator)
+		acceptor := wampproto.NewAcceptor(serializer, NewAuthenticator())
+
+		hello, err := joiner.SendHello()
+		require.NoError(t, err)
+		challenge, _, err := acceptor.Receive(hello)
+		require.NoError(t, err)
+		_, err = joiner.Receive(challenge)
+		require.NoError(t, err)
+
+		// a router that doesn't know the credential cannot compute the server signature
+		welcome := messages.NewWelcome(1, map[string]any{
+			"authid":    authID,
+			"authrole":  "anonymous",
+			"authextra": map[string]any{"scram_server_signature": "Zm9yZ2Vk"},
+		})
+		_, err = joiner.ReceiveMessage(welcome)
+		require.EqualError(t, err, "scram: invalid server signature")
+	})
+}
+
 func TestCryptosignAuth(t *testing.T) {
 	t.Run("JSONSerializer", func(t *testing.T) {
 		jsonSerializer := &serializers.JSONSerializer{}
@@ -281,6 +367,44 @@ func TestCryptosignAuth(t *testing.T) {
 	})
 }
 
+func TestCryptosignChannelBinding(t *testing.T) {
+	binding := &auth.ChannelBinding{Type: auth.ChannelBindingTLSExporter, Data: make([]byte, 32)}
+	for i := range binding.Data {
+		binding.Data[i] = byte(i)
+	}
+	options := &wampproto.AcceptorOptions{ChannelBinding: binding}
+
+	t.Run("Bound", func(t *testing.T) {
+		cryptosignAuthenticator, err := auth.NewCryptoSignAuthenticatorWithChannelBinding(authID, privateKey, nil,
+			binding)
+		require.NoError(t, err)
+		require.NoError(t, testAuthWithOptions(t, cryptosignAuthenticator, &serializers.JSONSerializer{}, options))
+	})
+
+	t.Run("Unbound", func(t *testing.T) {
+		cryptosignAuthenticator, err := auth.NewCryptoSignAuthenticator(authID, privateKey, nil)
+		require.NoError(t, err)
+		require.NoError(t, testAuthWithOptions(t, cryptosignAuthenticator, &serializers.JSONSerializer{}, options))
+	})
+
+	t.Run("DifferentChannel", func(t *testing.T) {
+		other := &auth.ChannelBinding{Type: auth.ChannelBindingTLSExporter, Data: make([]byte, 32)}
+		cryptosignAuthenticator, err := auth.NewCryptoSignAuthenticatorWithChannelBinding(authID, privateKey, nil,
+			other)
+		require.NoError(t, err)
+		err = testAuthWithOptions(t, cryptosignAuthenticator, &serializers.JSONSerializer{}, options)
+		require.EqualError(t, err, "wamp.error.authentication_failed")
+	})
+
+	t.Run("BindingUnavailable", func(t *testing.T) {
+		cryptosignAuthenticator, err := auth.NewCryptoSignAuthenticatorWithChannelBinding(authID, privateKey, nil,
+			binding)
+		require.NoError(t, err)
+		err = testAuthWithOptions(t, cryptosignAuthenticator, &serializers.JSONSerializer{}, nil)
+		require.EqualError(t, err, "wamp.error.authentication_failed")
+	})
+}
+
 type testAuthenticator struct {
 }
 
@@ -347,3 +471,471 @@ func TestNilRoles(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, map[string]any{}, d.RouterRoles())
 }
+
+type testSessionStore struct {
+	tokens map[string]*wampproto.SessionDetails
+	issued int
+}
+
+func (s *testSessionStore) IssueToken(realm string, sessionID uint64) (string, error) {
+	s.issued++
+	token := fmt.Sprintf("token-%d", s.issued)
+	s.tokens[token] = wampproto.NewSessionDetails(sessionID, realm, authID, "anonymous", "anonymous", false, nil, nil)
+	return token, nil
+}
+
+func (s *testSessionStore) Resume(_, token string) (*wampproto.SessionDetails, bool) {
+	details, ok := s.tokens[token]
+	delete(s.tokens, token)
+	return details, ok
+}
+
+func TestSessionResumption(t *testing.T) {
+	store := &testSessionStore{tokens: make(map[string]*wampproto.SessionDetails)}
+	join := func(joiner *wampproto.Joiner) *wampproto.SessionDetails {
+		acceptor := wampproto.NewAcceptor(&serializers.JSONSerializer{}, NewAuthenticator())
+		acceptor.SetSessionStore(store)
+
+		hello, err := joiner.SendHello()
+		require.NoError(t, err)
+		welcome, welcomed, err := acceptor.Receive(hello)
+		require.NoError(t, err)
+		require.True(t, welcomed)
+		_, err = joiner.Receive(welcome)
+		require.NoError(t, err)
+
+		details, err := joiner.SessionDetails()
+		require.NoError(t, err)
+		return details
+	}
+
+	joiner := wampproto.NewJoiner(realm, &serializers.JSONSerializer{}, auth.NewAnonymousAuthenticator(authID, nil))
+	details := join(joiner)
+	require.Empty(t, details.ResumeToken())
+
+	joiner.SetResumable(true)
+	details = join(joiner)
+	require.NotEmpty(t, details.ResumeToken())
+	require.False(t, details.Resumed())
+
+	joiner.SetResumeToken(details.ResumeToken())
+	resumed := join(joiner)
+	require.True(t, resumed.Resumed())
+	require.Equal(t, details.ID(), resumed.ID())
+	require.NotEqual(t, details.ResumeToken(), resumed.ResumeToken())
+
+	// the token was used already
+	fresh := join(joiner)
+	require.False(t, fresh.Resumed())
+	require.NotEqual(t, details.ID(), fresh.ID())
+}
+
+func TestFeatureNegotiation(t *testing.T) {
+	joinWithRoles := func(roles map[string]any) *wampproto.SessionDetails {
+		acceptor := wampproto.NewAcceptor(&serializers.JSONSerializer{}, nil)
+		hello := messages.NewHello(realm, "", nil, roles, []string{"anonymous"})
+		welcome, err := acceptor.ReceiveMessage(hello)
+		require.NoError(t, err)
+		require.IsType(t, &messages.Welcome{}, welcome)
+
+		details, err := acceptor.SessionDetails()
+		require.NoError(t, err)
+		return details
+	}
+
+	caller := joinWithRoles(map[string]any{
+		"caller": map[string]any{"features": map[string]any{
+			wampproto.FeatureProgressiveCallInvocations: true,
+			"unknown_feature": true,
+		}},
+	})
+	require.True(t, caller.HasFeature("caller", wampproto.FeatureProgressiveCallInvocations))
+	require.False(t, caller.HasFeature("caller", wampproto.FeatureProgressiveCallResults))
+	require.False(t, caller.HasFeature("caller", "unknown_feature"))
+	require.False(t, caller.HasFeature("callee", wampproto.FeatureProgressiveCallInvocations))
+
+	callee := joinWithRoles(wampproto.DefaultClientRoles())
+	require.True(t, callee.HasFeature("callee", wampproto.FeatureProgressiveCallResults))
+
+	dealer := wampproto.NewDealer()
+	require.NoError(t, dealer.AddSession(caller))
+	require.NoError(t, dealer.AddSession(callee))
+	_, err := dealer.ReceiveMessage(callee.ID(), messages.NewRegister(1, nil, "foo.bar"))
+	require.NoError(t, err)
+
+	options := map[string]any{wampproto.OptionReceiveProgress: true}
+	result, err := dealer.ReceiveMessage(caller.ID(), messages.NewCall(1, options, "foo.bar", nil, nil))
+	require.NoError(t, err)
+	require.Equal(t, wampproto.ErrFeatureNotSupported, result.Message.(*messages.Error).URI())
+
+	options = map[string]any{wampproto.OptionProgress: true}
+	result, err = dealer.ReceiveMessage(caller.ID(), messages.NewCall(2, options, "foo.bar", nil, nil))
+	require.NoError(t, err)
+	require.Equal(t, messages.MessageTypeInvocation, result.Message.Type())
+}
+
+func TestConfigurableRoles(t *testing.T) {
+	dealer := wampproto.NewDealer()
+	dealer.AllowDiscloseCaller(false)
+	acceptors := map[string]*wampproto.Acceptor{
+		"default": wampproto.NewAcceptor(&serializers.JSONSerializer{}, nil),
+		"static": wampproto.NewAcceptorWithOptions(&serializers.JSONSerializer{}, nil,
+			&wampproto.AcceptorOptions{Roles: dealer.Roles()}),
+		"realm": wampproto.NewAcceptorWithOptions(&serializers.JSONSerializer{}, nil, &wampproto.AcceptorOptions{
+			Roles: dealer.Roles(),
+			RealmRoles: func(string) map[string]any {
+				return wampproto.NewBroker().Roles()
+			},
+		}),
+	}
+
+	roles := make(map[string]map[string]any)
+	for name, acceptor := range acceptors {
+		joiner := wampproto.NewJoinerWithOptions(realm, &serializers.JSONSerializer{}, nil,
+			&wampproto.JoinerOptions{Roles: map[string]any{"subscriber": map[string]any{}}})
+		hello, err := joiner.SendHello()
+		require.NoError(t, err)
+
+		welcome, _, err := acceptor.Receive(hello)
+		require.NoError(t, err)
+
+		_, err = joiner.Receive(welcome)
+		require.NoError(t, err)
+
+		details, err := joiner.SessionDetails()
+		require.NoError(t, err)
+		roles[name] = details.RouterRoles()
+		require.Equal(t, map[string]map[string]bool{"subscriber": {}}, details.Features())
+	}
+
+	require.Equal(t, wampproto.DefaultRouterRoles(), roles["default"])
+	require.Equal(t, dealer.Roles(), roles["static"])
+	require.Equal(t, wampproto.NewBroker().Roles(), roles["realm"])
+
+	features := roles["static"]["dealer"].(map[string]any)["features"].(map[string]any)
+	require.Equal(t, false, features[wampproto.FeatureCallerIdentification])
+
+	// the defaults announce what the dealer implements, it has no call canceling
+	require.Equal(t, wampproto.NewDealer().Roles()["dealer"], roles["default"]["dealer"])
+	defaultFeatures := roles["default"]["dealer"].(map[string]any)["features"].(map[string]any)
+	require.NotContains(t, defaultFeatures, wampproto.FeatureCallCancelling)
+}
+
+func TestAcceptorOptions(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	newAcceptor := func() *wampproto.Acceptor {
+		return wampproto.NewAcceptorWithOptions(&serializers.JSONSerializer{}, nil, &wampproto.AcceptorOptions{
+			AllowedRealms:  []string{realm},
+			IDGenerator:    &counterIDGenerator{},
+			Now:            func() time.Time { return createdAt },
+			MaxPayloadSize: 256,
+		})
+	}
+
+	t.Run("Welcome", func(t *testing.T) {
+		acceptor := newAcceptor()
+		welcome, err := acceptor.ReceiveMessage(messages.NewHello(realm, "", nil, nil, []string{"anonymous"}))
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), welcome.(*messages.Welcome).SessionID())
+
+		details, err := acceptor.SessionDetails()
+		require.NoError(t, err)
+		require.Equal(t, "2024-03-01T12:00:00Z", details.CreatedAt())
+	})
+
+	t.Run("RealmNotAllowed", func(t *testing.T) {
+		abort, err := newAcceptor().ReceiveMessage(messages.NewHello("realm2", "", nil, nil, []string{"anonymous"}))
+		require.NoError(t, err)
+		require.Equal(t, wampproto.ErrNoSuchRealm, abort.(*messages.Abort).Reason())
+	})
+
+	t.Run("PayloadTooLarge", func(t *testing.T) {
+		hello := messages.NewHello(realm, strings.Repeat("a", 256), nil, nil, []string{"anonymous"})
+		payload, err := (&serializers.JSONSerializer{}).Serialize(hello)
+		require.NoError(t, err)
+
+		_, _, err = newAcceptor().Receive(payload)
+		require.True(t, wampproto.IsProtocolViolation(err))
+	})
+}
+
+type realmAuthenticator struct {
+	realms []string
+}
+
+func (a *realmAuthenticator) Methods() []auth.Method {
+	return []auth.Method{auth.Anonymous}
+}
+
+func (a *realmAuthenticator) Authenticate(request auth.Request) (auth.Response, error) {
+	a.realms = append(a.realms, request.Realm())
+	return auth.NewResponse(request.AuthID(), "anonymous", 0)
+}
+
+func TestAcceptorRealmRegistry(t *testing.T) {
+	join := func(registry wampproto.RealmRegistry, autoCreate bool, realm string) (messages.Message, []string) {
+		authenticator := &realmAuthenticator{}
+		acceptor := wampproto.NewAcceptorWithOptions(&serializers.JSONSerializer{}, authenticator,
+			&wampproto.AcceptorOptions{RealmRegistry: registry, AutoCreateRealms: autoCreate})
+
+		msg, err := acceptor.ReceiveMessage(messages.NewHello(realm, "", nil, nil, []string{"anonymous"}))
+		require.NoError(t, err)
+		return msg, authenticator.realms
+	}
+
+	t.Run("UnknownRealm", func(t *testing.T) {
+		msg, realms := join(wampproto.NewStaticRealms("realm1"), false, "realm2")
+		require.Equal(t, wampproto.ErrNoSuchRealm, msg.(*messages.Abort).Reason())
+		require.Empty(t, realms)
+	})
+
+	t.Run("ResolvedRealm", func(t *testing.T) {
+		aliases := wampproto.RealmResolverFunc(func(realm string) (string, bool) {
+			if realm == "default" {
+				return "realm1", true
+			}
+
+			return realm, realm == "realm1"
+		})
+
+		msg, realms := join(aliases, false, "default")
+		require.Equal(t, "realm1", msg.(*messages.Welcome).Details()["realm"])
+		require.Equal(t, []string{"realm1"}, realms)
+
+		// a registry that can't create realms is not affected by AutoCreateRealms
+		msg, _ = join(aliases, true, "realm2")
+		require.Equal(t, wampproto.ErrNoSuchRealm, msg.(*messages.Abort).Reason())
+	})
+
+	t.Run("AutoCreate", func(t *testing.T) {
+		registry := wampproto.NewStaticRealms()
+		msg, realms := join(registry, true, "realm2")
+		require.IsType(t, &messages.Welcome{}, msg)
+		require.Equal(t, []string{"realm2"}, realms)
+
+		_, exists := registry.ResolveRealm("realm2")
+		require.True(t, exists)
+	})
+}
+
+type tenantAuthenticator struct {
+	// plain responses implement auth.Response only
+	plain bool
+}
+
+func (a *tenantAuthenticator) Methods() []auth.Method {
+	return []auth.Method{auth.Ticket}
+}
+
+func (a *tenantAuthenticator) Authenticate(request auth.Request) (auth.Response, error) {
+	if a.plain {
+		return &plainResponse{authID: request.AuthID()}, nil
+	}
+
+	return auth.NewResponseWithExtra(request.AuthID(), "user", "tenants", map[string]any{"tenant": "acme"}, 0)
+}
+
+type plainResponse struct {
+	authID string
+}
+
+func (r *plainResponse) AuthID() string     { return r.authID }
+func (r *plainResponse) AuthRole() string   { return "user" }
+func (r *plainResponse) TTL() time.Duration { return 0 }
+
+func TestWelcomeAuthExtra(t *testing.T) {
+	join := func(t *testing.T, authenticator *tenantAuthenticator, clientExtra map[string]any) (
+		*wampproto.SessionDetails, *wampproto.SessionDetails) {
+		serializer := &serializers.JSONSerializer{}
+		joiner := wampproto.NewJoiner(realm, serializer, auth.NewTicketAuthenticator(authID, ticket, clientExtra))
+		acceptor := wampproto.NewAcceptor(serializer, authenticator)
+
+		hello, err := joiner.SendHello()
+		require.NoError(t, err)
+
+		challenge, _, err := acceptor.Receive(hello)
+		require.NoError(t, err)
+
+		authenticate, err := joiner.Receive(challenge)
+		require.NoError(t, err)
+
+		welcome, welcomed, err := acceptor.Receive(authenticate)
+		require.NoError(t, err)
+		require.True(t, welcomed)
+
+		_, err = joiner.Receive(welcome)
+		require.NoError(t, err)
+
+		clientDetails, err := joiner.SessionDetails()
+		require.NoError(t, err)
+		routerDetails, err := acceptor.SessionDetails()
+		require.NoError(t, err)
+		return clientDetails, routerDetails
+	}
+
+	clientDetails, routerDetails := join(t, &tenantAuthenticator{}, map[string]any{"device": "phone"})
+	require.Equal(t, "tenants", clientDetails.AuthProvider())
+	require.Equal(t, map[string]any{"tenant": "acme"}, clientDetails.AuthExtra())
+
+	// the router side keeps what the client sent apart from what the authenticator vouches for
+	require.Equal(t, "tenants", routerDetails.AuthProvider())
+	require.Equal(t, map[string]any{"tenant": "acme"}, routerDetails.AuthExtra())
+	require.Equal(t, map[string]any{"device": "phone"}, routerDetails.ClientAuthExtra())
+
+	t.Run("PlainResponse", func(t *testing.T) {
+		clientDetails, routerDetails := join(t, &tenantAuthenticator{plain: true}, map[string]any{"device": "phone"})
+		require.Equal(t, "static", clientDetails.AuthProvider())
+		require.Empty(t, clientDetails.AuthExtra())
+		require.Empty(t, routerDetails.AuthExtra())
+		require.Equal(t, map[string]any{"device": "phone"}, routerDetails.ClientAuthExtra())
+	})
+
+	t.Run("SpoofedTenant", func(t *testing.T) {
+		_, routerDetails := join(t, &tenantAuthenticator{}, map[string]any{"tenant": "globex"})
+		require.Equal(t, map[string]any{"tenant": "acme"}, routerDetails.AuthExtra())
+
+		broker := wampproto.NewBroker()
+		publisher := wampproto.NewSessionDetails(routerDetails.ID()+1, realm, "publisher", "backend", "", false,
+			wampproto.DefaultRouterRoles(), nil)
+		require.NoError(t, broker.AddSession(routerDetails))
+		require.NoError(t, broker.AddSession(publisher))
+		_, err := broker.ReceiveMessage(routerDetails.ID(), messages.NewSubscribe(1, nil, "foo.bar"))
+		require.NoError(t, err)
+
+		options := map[string]any{wampproto.OptEligibleAuthExtra: map[string]any{"tenant": "globex"}}
+		publication, err := broker.ReceivePublish(publisher.ID(), messages.NewPublish(2, options, "foo.bar", nil, nil))
+		require.NoError(t, err)
+		require.Empty(t, publication.Recipients)
+
+		options = map[string]any{wampproto.OptEligibleAuthExtra: map[string]any{"tenant": "acme"}}
+		publication, err = broker.ReceivePublish(publisher.ID(), messages.NewPublish(3, options, "foo.bar", nil, nil))
+		require.NoError(t, err)
+		require.Equal(t, []uint64{routerDetails.ID()}, publication.Recipients)
+	})
+}
+
+func TestCryptosignCertificateAuth(t *testing.T) {
+	rootKey, deviceKey := make([]byte, 32), make([]byte, 32)
+	_, err := rand.Read(rootKey)
+	require.NoError(t, err)
+	_, err = rand.Read(deviceKey)
+	require.NoError(t, err)
+	rootAddress, err := auth.EthereumAddress(rootKey)
+	require.NoError(t, err)
+	deviceAddress, err := auth.EthereumAddress(deviceKey)
+	require.NoError(t, err)
+
+	realmAddress := "0x163d58ce482560b7826b4612f40aa2a7d53310c4"
+	delegate := &auth.CryptoSignDelegateCertificate{ChainID: 1, CSPubKey: publicKey, BootedAt: 1700000000,
+		VerifyingContract: "0xf766dc789cf04cd18ae75af2c5fac2da6650c1b3"}
+	require.NoError(t, delegate.Sign(deviceKey))
+	chain := &auth.CryptoSignCertificateChain{Delegate: delegate}
+	for _, certificate := range []*auth.CryptoSignAuthorityCertificate{
+		{Subject: deviceAddress, Capabilities: auth.CryptoSignCapabilityConsumer},
+		{Subject: rootAddress, Capabilities: auth.CryptoSignCapabilityRootCA | auth.CryptoSignCapabilityConsumer},
+	} {
+		certificate.ChainID, certificate.VerifyingContract = delegate.ChainID, delegate.VerifyingContract
+		certificate.Realm = realmAddress
+		require.NoError(t, certificate.Sign(rootKey))
+		chain.Authorities = append(chain.Authorities, certificate)
+	}
+	extra := auth.CryptoSignCertificatesExtra(chain, rootAddress)
+
+	authenticator, err := auth.NewCryptoSignCertificateAuthenticator(auth.CryptoSignCertificateOptions{
+		TrustRoots: []string{rootAddress},
+		Realms:     map[string]string{realmAddress: realm},
+		AuthRole:   "device",
+	})
+	require.NoError(t, err)
+
+	for name, serializer := range map[string]serializers.Serializer{
+		"JSONSerializer":    &serializers.JSONSerializer{},
+		"CBORSerializer":    &serializers.CBORSerializer{},
+		"MsgPackSerializer": &serializers.MsgPackSerializer{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cryptosignAuthenticator, err := auth.NewCryptoSignAuthenticator("", privateKey, extra)
+			require.NoError(t, err)
+			joiner := wampproto.NewJoiner(realm, serializer, cryptosignAuthenticator)
+			acceptor := wampproto.NewAcceptor(serializer, authenticator)
+
+			hello, err := joiner.SendHello()
+			require.NoError(t, err)
+
+			challenge, _, err := acceptor.Receive(hello)
+			require.NoError(t, err)
+
+			authenticate, err := joiner.Receive(challenge)
+			require.NoError(t, err)
+
+			welcome, welcomed, err := acceptor.Receive(authenticate)
+			require.NoError(t, err)
+			require.True(t, welcomed)
+
+			_, err = joiner.Receive(welcome)
+			require.NoError(t, err)
+
+			details, err := joiner.SessionDetails()
+			require.NoError(t, err)
+			require.Equal(t, deviceAddress, details.AuthID())
+			require.Equal(t, "device", details.AuthRole())
+		})
+	}
+}
+
+func TestCRAChallenge(t *testing.T) {
+	serializer := &serializers.JSONSerializer{}
+	now := time.Unix(1700000000, 0)
+	options := &wampproto.AcceptorOptions{
+		ChallengeTTL: time.Minute,
+		AuthProvider: "users",
+		Now:          func() time.Time { return now },
+	}
+
+	challenge := func(t *testing.T) (*wampproto.Acceptor, *messages.Challenge, []byte) {
+		acceptor := wampproto.NewAcceptorWithOptions(serializer, NewAuthenticator(), options)
+		joiner := wampproto.NewJoiner(realm, serializer, auth.NewWAMPCRAAuthenticator(authID, secret, nil))
+		hello, err := joiner.SendHello()
+		require.NoError(t, err)
+
+		challengePayload, _, err := acceptor.Receive(hello)
+		require.NoError(t, err)
+		challenge, err := serializer.Deserialize(challengePayload)
+		require.NoError(t, err)
+
+		authenticate, err := joiner.Receive(challengePayload)
+		require.NoError(t, err)
+
+		return acceptor, challenge.(*messages.Challenge), authenticate
+	}
+
+	t.Run("Welcome", func(t *testing.T) {
+		acceptor, challenge, authenticate := challenge(t)
+		challengeExtra := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(challenge.Extra()["challenge"].(string)), &challengeExtra))
+		require.Equal(t, "users", challengeExtra["authprovider"])
+		require.Equal(t, auth.ISO8601(now), challengeExtra["timestamp"])
+
+		welcomePayload, welcomed, err := acceptor.Receive(authenticate)
+		require.NoError(t, err)
+		require.True(t, welcomed)
+
+		welcome, err := serializer.Deserialize(welcomePayload)
+		require.NoError(t, err)
+		require.Equal(t, challengeExtra["session"], float64(welcome.(*messages.Welcome).SessionID()))
+		require.Equal(t, "users", welcome.(*messages.Welcome).Details()["authprovider"])
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		acceptor, _, authenticate := challenge(t)
+		now = now.Add(time.Minute + time.Second)
+
+		payload, welcomed, err := acceptor.Receive(authenticate)
+		require.NoError(t, err)
+		require.False(t, welcomed)
+
+		abort, err := serializer.Deserialize(payload)
+		require.NoError(t, err)
+		require.Equal(t, wampproto.ErrAuthenticationFailed, abort.(*messages.Abort).Reason())
+	})
+}
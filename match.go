@@ -0,0 +1,120 @@
+package wampproto
+
+import (
+	"path"
+	"strings"
+)
+
+// uriMatch keys registrations and subscriptions, the same URI may be registered or
+// subscribed to with each match policy.
+type uriMatch struct {
+	uri   string
+	match string
+}
+
+// matchPolicies are the match policies in order of precedence.
+var matchPolicies = []string{MatchExact, MatchPrefix, MatchWildcard} //nolint:gochecknoglobals
+
+// normalizeMatch returns the match policy an option value stands for.
+func normalizeMatch(match string) string {
+	if match == "" {
+		return MatchExact
+	}
+
+	return match
+}
+
+// validMatch reports whether match is a known value of the match option, an empty
+// value stands for exact matching.
+func validMatch(match string) bool {
+	switch match {
+	case "", MatchExact, MatchPrefix, MatchWildcard:
+		return true
+	default:
+		return false
+	}
+}
+
+// validInvoke reports whether invoke is a known invocation policy, an empty value stands
+// for single.
+func validInvoke(invoke string) bool {
+	switch invoke {
+	case "", InvokeSingle, InvokeFirst, InvokeLast, InvokeRoundRobin, InvokeRandom:
+		return true
+	default:
+		return false
+	}
+}
+
+// wildcardMatch matches uri against a wildcard pattern. Empty URI components in the
+// pattern match any single component as defined by WAMP, e.g. "com..create" matches
+// "com.user.create"; glob patterns as understood by path.Match are supported as well.
+func wildcardMatch(uri, pattern string) bool {
+	if matched, err := path.Match(pattern, uri); err == nil && matched {
+		return true
+	}
+
+	patternComponents := strings.Split(pattern, ".")
+	uriComponents := strings.Split(uri, ".")
+	if len(patternComponents) != len(uriComponents) {
+		return false
+	}
+
+	for i, component := range patternComponents {
+		if component != "" && component != uriComponents[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// moreSpecificWildcard reports whether wildcard pattern a takes precedence over b: the
+// pattern with more non-empty components wins, then the one with more literal characters.
+// Remaining ties are broken lexicographically so that matching is deterministic.
+func moreSpecificWildcard(a, b string) bool {
+	aComponents, bComponents := nonEmptyComponents(a), nonEmptyComponents(b)
+	if aComponents != bComponents {
+		return aComponents > bComponents
+	}
+
+	aLiterals, bLiterals := literalLength(a), literalLength(b)
+	if aLiterals != bLiterals {
+		return aLiterals > bLiterals
+	}
+
+	return a < b
+}
+
+func nonEmptyComponents(pattern string) int {
+	count := 0
+	for _, component := range strings.Split(pattern, ".") {
+		if component != "" {
+			count++
+		}
+	}
+
+	return count
+}
+
+func literalLength(pattern string) int {
+	return len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+}
+
+// bestWildcardMatch returns the most specific wildcard pattern in patterns matching uri.
+func bestWildcardMatch[T any](uri string, patterns map[string]T) (T, bool) {
+	var best T
+	bestPattern := ""
+	found := false
+	for pattern, value := range patterns {
+		if !wildcardMatch(uri, pattern) {
+			continue
+		}
+
+		if !found || moreSpecificWildcard(pattern, bestPattern) {
+			best, bestPattern, found = value, pattern, true
+		}
+	}
+
+	return best, found
+}
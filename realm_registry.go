@@ -0,0 +1,56 @@
+package wampproto
+
+import (
+	"sync"
+)
+
+// RealmRegistry tells an Acceptor which realms clients may join.
+type RealmRegistry interface {
+	// ResolveRealm returns the realm a client joins when it asks for realm in HELLO, and
+	// false if there is no such realm.
+	ResolveRealm(realm string) (string, bool)
+}
+
+// RealmCreator is implemented by registries that can add realms. With
+// AcceptorOptions.AutoCreateRealms the Acceptor creates unknown realms on first join.
+type RealmCreator interface {
+	CreateRealm(realm string) error
+}
+
+// RealmResolverFunc adapts a function to a RealmRegistry.
+type RealmResolverFunc func(realm string) (string, bool)
+
+func (f RealmResolverFunc) ResolveRealm(realm string) (string, bool) {
+	return f(realm)
+}
+
+// StaticRealms is a RealmRegistry of a fixed list of realms that may grow with CreateRealm.
+type StaticRealms struct {
+	realms map[string]struct{}
+	sync.RWMutex
+}
+
+func NewStaticRealms(realms ...string) *StaticRealms {
+	s := &StaticRealms{realms: make(map[string]struct{}, len(realms))}
+	for _, realm := range realms {
+		s.realms[realm] = struct{}{}
+	}
+
+	return s
+}
+
+func (s *StaticRealms) ResolveRealm(realm string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, exists := s.realms[realm]
+	return realm, exists
+}
+
+func (s *StaticRealms) CreateRealm(realm string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.realms[realm] = struct{}{}
+	return nil
+}
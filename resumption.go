@@ -0,0 +1,22 @@
+package wampproto
+
+const (
+	// OptionResumable in HELLO.Details.authextra asks the router to issue a resume token.
+	OptionResumable = "resumable"
+	// OptionResumeToken in HELLO.Details.authextra asks the router to resume the detached
+	// session the token was issued for. In WELCOME.Details it carries the token to use on
+	// the next reconnect.
+	OptionResumeToken = "resume_token"
+	// OptionResumed in WELCOME.Details tells whether an earlier session was resumed.
+	OptionResumed = "resumed"
+)
+
+// SessionStore keeps track of resumable sessions. It is implemented by routers that keep
+// the state of a session whose transport was lost for a grace period.
+type SessionStore interface {
+	// IssueToken returns a new resume token for the session, replacing earlier tokens.
+	IssueToken(realm string, sessionID uint64) (string, error)
+	// Resume returns the details of the session the token was issued for and holds the
+	// session for the resuming client. The token is used up once the client is reattached.
+	Resume(realm, token string) (*SessionDetails, bool)
+}
@@ -0,0 +1,144 @@
+package router
+
+import (
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/util"
+)
+
+// handleMetaCall answers calls to the meta procedures implemented by the realm. The
+// returned message is not addressed, the caller sets the recipient.
+func (r *Realm) handleMetaCall(sessionID uint64, call *messages.Call) (*wampproto.MessageWithRecipient, bool) {
+	var handler func(uint64, *messages.Call) *wampproto.MessageWithRecipient
+	switch call.Procedure() {
+	case wampproto.MetaProcSubscriptionGetEvents:
+		handler = r.subscriptionGetEvents
+	case wampproto.MetaProcSessionAddTestament:
+		handler = r.sessionAddTestament
+	case wampproto.MetaProcSessionFlushTestaments:
+		handler = r.sessionFlushTestaments
+	default:
+		return nil, false
+	}
+
+	// meta procedures are authorized like the procedures of callees
+	denied, err := r.dealer.AuthorizeCall(sessionID, call)
+	if err != nil {
+		return callError(call, wampproto.ErrAuthorizationFailed, err.Error()), true
+	}
+
+	if denied != nil {
+		return denied, true
+	}
+
+	return handler(sessionID, call), true
+}
+
+// subscriptionGetEvents implements wamp.subscription.get_events(subscription_id, limit|None).
+func (r *Realm) subscriptionGetEvents(sessionID uint64, call *messages.Call) *wampproto.MessageWithRecipient {
+	if len(call.Args()) == 0 {
+		return callError(call, wampproto.ErrInvalidArgument, "subscription ID is required")
+	}
+
+	subscriptionID, ok := util.AsUInt64(call.Args()[0])
+	if !ok {
+		return callError(call, wampproto.ErrInvalidArgument, "subscription ID must be an integer")
+	}
+
+	limit := 0
+	if len(call.Args()) > 1 && call.Args()[1] != nil {
+		limit, ok = util.AsInt(call.Args()[1])
+		if !ok || limit < 0 {
+			return callError(call, wampproto.ErrInvalidArgument, "limit must be a positive integer")
+		}
+	}
+
+	events, err := r.broker.EventHistory(sessionID, subscriptionID, limit)
+	if err != nil {
+		return callError(call, wampproto.ErrNoSuchSubscription, err.Error())
+	}
+
+	history := make([]any, 0, len(events))
+	for _, event := range events {
+		history = append(history, map[string]any{
+			"subscription": event.SubscriptionID(),
+			"publication":  event.PublicationID(),
+			"topic":        event.Details()["topic"],
+			"args":         event.Args(),
+			"kwargs":       event.KwArgs(),
+		})
+	}
+
+	return &wampproto.MessageWithRecipient{Message: messages.NewResult(call.RequestID(), nil, history, nil)}
+}
+
+// sessionAddTestament implements
+// wamp.session.add_testament(topic, args, kwargs, publish_options=None, scope=None).
+func (r *Realm) sessionAddTestament(sessionID uint64, call *messages.Call) *wampproto.MessageWithRecipient {
+	if len(call.Args()) < 3 {
+		return callError(call, wampproto.ErrInvalidArgument, "topic, args and kwargs are required")
+	}
+
+	topic, ok := util.AsString(call.Args()[0])
+	if !ok || topic == "" {
+		return callError(call, wampproto.ErrInvalidArgument, "topic must be a non-empty string")
+	}
+
+	args, _ := call.Args()[1].([]any)
+	kwArgs, _ := call.Args()[2].(map[string]any)
+
+	// publish_options and scope are usually keyword arguments but may be positional
+	publishOptionsArg, scopeArg := call.KwArgs()["publish_options"], call.KwArgs()[wampproto.OptionScope]
+	if len(call.Args()) > 3 && publishOptionsArg == nil {
+		publishOptionsArg = call.Args()[3]
+	}
+
+	if len(call.Args()) > 4 && scopeArg == nil {
+		scopeArg = call.Args()[4]
+	}
+
+	publishOptions := map[string]any{}
+	if publishOptionsArg != nil {
+		if publishOptions, ok = publishOptionsArg.(map[string]any); !ok {
+			return callError(call, wampproto.ErrInvalidArgument, "publish_options must be a dict")
+		}
+	}
+
+	scope := ""
+	if scopeArg != nil {
+		if scope, ok = util.AsString(scopeArg); !ok {
+			return callError(call, wampproto.ErrInvalidArgument, "scope must be a string")
+		}
+	}
+
+	testament := wampproto.Testament{Topic: topic, Args: args, KwArgs: kwArgs, Options: publishOptions}
+	if err := r.broker.AddTestament(sessionID, scope, testament); err != nil {
+		return callError(call, wampproto.ErrInvalidArgument, err.Error())
+	}
+
+	return &wampproto.MessageWithRecipient{Message: messages.NewResult(call.RequestID(), nil, nil, nil)}
+}
+
+// sessionFlushTestaments implements wamp.session.flush_testaments(scope|None) and returns
+// the number of testaments removed.
+func (r *Realm) sessionFlushTestaments(sessionID uint64, call *messages.Call) *wampproto.MessageWithRecipient {
+	scope := ""
+	if len(call.Args()) > 0 && call.Args()[0] != nil {
+		var ok bool
+		if scope, ok = util.AsString(call.Args()[0]); !ok {
+			return callError(call, wampproto.ErrInvalidArgument, "scope must be a string")
+		}
+	}
+
+	flushed, err := r.broker.FlushTestaments(sessionID, scope)
+	if err != nil {
+		return callError(call, wampproto.ErrInvalidArgument, err.Error())
+	}
+
+	return &wampproto.MessageWithRecipient{Message: messages.NewResult(call.RequestID(), nil, []any{flushed}, nil)}
+}
+
+func callError(call *messages.Call, uri, reason string) *wampproto.MessageWithRecipient {
+	errMsg := messages.NewError(messages.MessageTypeCall, call.RequestID(), map[string]any{}, uri, []any{reason}, nil)
+	return &wampproto.MessageWithRecipient{Message: errMsg}
+}
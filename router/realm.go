@@ -0,0 +1,598 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/messages"
+)
+
+// maxBufferedMessages is the number of messages kept for a suspended session. A session
+// that would receive more is given up.
+const maxBufferedMessages = 256
+
+// suspendedSession is a resumable session whose connection was lost. Its registrations
+// and subscriptions stay in place until it resumes or the grace period expires.
+type suspendedSession struct {
+	details     *wampproto.SessionDetails
+	buffered    []messages.Message
+	gracePeriod time.Duration
+	timer       *time.Timer
+}
+
+// reservation holds a session for a client that presented its resume token until the
+// client is attached with ResumeSession.
+type reservation struct {
+	timer *time.Timer
+	// token is the resume token issued to the resuming client, earlier tokens stay valid
+	// until it is attached.
+	token string
+}
+
+// Realm routes messages between the sessions joined to it.
+type Realm struct {
+	name   string
+	dealer *wampproto.Dealer
+	broker *wampproto.Broker
+
+	sessions     map[uint64]*Session
+	suspended    map[uint64]*suspendedSession
+	reserved     map[uint64]*reservation
+	resumeTokens map[string]uint64
+	sync.RWMutex
+}
+
+func NewRealm(name string) *Realm {
+	return &Realm{
+		name:         name,
+		dealer:       wampproto.NewDealer(),
+		broker:       wampproto.NewBroker(),
+		sessions:     make(map[uint64]*Session),
+		suspended:    make(map[uint64]*suspendedSession),
+		reserved:     make(map[uint64]*reservation),
+		resumeTokens: make(map[string]uint64),
+	}
+}
+
+func (r *Realm) Name() string {
+	return r.name
+}
+
+// Roles returns the dealer and broker roles of the realm with the features they support.
+func (r *Realm) Roles() map[string]any {
+	roles := r.dealer.Roles()
+	for role, details := range r.broker.Roles() {
+		roles[role] = details
+	}
+
+	return roles
+}
+
+// SetURIValidation sets how procedure and topic URIs are validated.
+func (r *Realm) SetURIValidation(mode wampproto.URIValidationMode) {
+	r.dealer.SetURIValidation(mode)
+	r.broker.SetURIValidation(mode)
+}
+
+// SetAuthorizer sets the Authorizer asked before a CALL, REGISTER, PUBLISH or SUBSCRIBE is
+// processed, calls to meta procedures included.
+func (r *Realm) SetAuthorizer(authorizer wampproto.Authorizer) {
+	r.dealer.SetAuthorizer(authorizer)
+	r.broker.SetAuthorizer(authorizer)
+}
+
+// EnableEventHistory keeps the last limit events of every topic, retrievable by
+// subscribers with the wamp.subscription.get_events meta procedure.
+func (r *Realm) EnableEventHistory(limit int) {
+	r.broker.EnableEventHistory(limit)
+}
+
+func (r *Realm) AttachSession(session *Session) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, exists := r.sessions[session.ID()]; exists {
+		return fmt.Errorf("router: session %d already attached to realm %s", session.ID(), r.name)
+	}
+
+	if err := r.dealer.AddSession(session.Details()); err != nil {
+		return err
+	}
+
+	if err := r.broker.AddSession(session.Details()); err != nil {
+		_ = r.dealer.RemoveSession(session.ID())
+		return err
+	}
+
+	r.sessions[session.ID()] = session
+	return nil
+}
+
+// DetachSession removes the session, attached or suspended, and all its registrations
+// and subscriptions.
+func (r *Realm) DetachSession(id uint64) error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.detachSession(id)
+}
+
+// detachSession must be called with the lock held.
+func (r *Realm) detachSession(id uint64) error {
+	r.cancelReservation(id)
+	if suspended, exists := r.suspended[id]; exists {
+		suspended.timer.Stop()
+		r.removeSuspended(id)
+		return nil
+	}
+
+	if _, exists := r.sessions[id]; !exists {
+		return fmt.Errorf("router: session %d not attached to realm %s", id, r.name)
+	}
+
+	delete(r.sessions, id)
+	r.forgetResumeTokens(id)
+	detached, _ := r.broker.FireTestaments(id, wampproto.TestamentScopeDetached)
+	r.removeFromDealer(id)
+	r.removeFromBroker(id, detached...)
+
+	return nil
+}
+
+// SuspendSession detaches the session from its connection but keeps its registrations and
+// subscriptions for gracePeriod. Messages routed to it in the meantime are buffered and
+// delivered once it resumes with ResumeSession.
+func (r *Realm) SuspendSession(id uint64, gracePeriod time.Duration) error {
+	r.Lock()
+	defer r.Unlock()
+
+	session, exists := r.sessions[id]
+	if !exists {
+		return fmt.Errorf("router: session %d not attached to realm %s", id, r.name)
+	}
+
+	if session.Closing() {
+		return fmt.Errorf("router: session %d is closing", id)
+	}
+
+	r.suspendSession(session, gracePeriod)
+	return nil
+}
+
+// suspendSession must be called with the lock held.
+func (r *Realm) suspendSession(session *Session, gracePeriod time.Duration) {
+	delete(r.sessions, session.ID())
+	r.fireTestaments(session.ID(), wampproto.TestamentScopeDetached)
+
+	suspended := &suspendedSession{details: session.Details(), gracePeriod: gracePeriod}
+	suspended.timer = r.expireAfter(session.ID(), suspended)
+	r.suspended[session.ID()] = suspended
+}
+
+// expireAfter removes the suspended session once its grace period is over, unless a
+// resuming client reserved it meanwhile.
+func (r *Realm) expireAfter(id uint64, suspended *suspendedSession) *time.Timer {
+	return time.AfterFunc(suspended.gracePeriod, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		_, reserved := r.reserved[id]
+		if r.suspended[id] == suspended && !reserved {
+			r.removeSuspended(id)
+		}
+	})
+}
+
+// releaseSession suspends session for gracePeriod, or detaches it if gracePeriod is zero,
+// after its connection was lost. Nothing happens if a resuming client took it over.
+func (r *Realm) releaseSession(session *Session, gracePeriod time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.sessions[session.ID()] != session {
+		return
+	}
+
+	if gracePeriod > 0 && !session.Closing() {
+		r.suspendSession(session, gracePeriod)
+		return
+	}
+
+	_ = r.detachSession(session.ID())
+}
+
+// ResumeSession attaches session in place of the session with the same ID that its client
+// reserved by presenting the resume token. A suspended session gets the messages buffered
+// while it was suspended, one that is still attached to its old connection is taken over
+// and the old connection is closed.
+func (r *Realm) ResumeSession(session *Session) error {
+	r.Lock()
+	defer r.Unlock()
+
+	id := session.ID()
+	reserved, exists := r.reserved[id]
+	if !exists {
+		return fmt.Errorf("router: session %d not reserved for resumption in realm %s", id, r.name)
+	}
+
+	reserved.timer.Stop()
+	delete(r.reserved, id)
+
+	var buffered []messages.Message
+	if suspended, exists := r.suspended[id]; exists {
+		suspended.timer.Stop()
+		delete(r.suspended, id)
+		buffered = suspended.buffered
+	} else if previous, exists := r.sessions[id]; exists {
+		// the old connection is gone but we didn't notice yet
+		r.fireTestaments(id, wampproto.TestamentScopeDetached)
+		previous.Close()
+	} else {
+		return fmt.Errorf("router: session %d no longer exists in realm %s", id, r.name)
+	}
+
+	r.sessions[id] = session
+
+	// the earlier tokens are used up once the session is reattached
+	for token, sessionID := range r.resumeTokens {
+		if sessionID == id && token != reserved.token {
+			delete(r.resumeTokens, token)
+		}
+	}
+
+	for _, msg := range buffered {
+		if err := session.Send(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cancelReservation must be called with the lock held. A suspended session gets a new
+// grace period, the token issued to the client that failed to resume is dropped.
+func (r *Realm) cancelReservation(id uint64) {
+	reserved, exists := r.reserved[id]
+	if !exists {
+		return
+	}
+
+	reserved.timer.Stop()
+	delete(r.reserved, id)
+	delete(r.resumeTokens, reserved.token)
+
+	if suspended, exists := r.suspended[id]; exists {
+		suspended.timer = r.expireAfter(id, suspended)
+	}
+}
+
+// removeSuspended must be called with the lock held.
+func (r *Realm) removeSuspended(id uint64) {
+	delete(r.suspended, id)
+	r.forgetResumeTokens(id)
+	r.removeFromDealer(id)
+	r.removeFromBroker(id)
+}
+
+// fireTestaments publishes the testaments of the session in the given scope.
+func (r *Realm) fireTestaments(id uint64, scope string) {
+	publications, _ := r.broker.FireTestaments(id, scope)
+	r.publishLater(publications)
+}
+
+// removeFromDealer removes the session from the dealer and fails the calls still waiting
+// for it as callee.
+func (r *Realm) removeFromDealer(id uint64) {
+	canceled, _ := r.dealer.RemoveSessionWithCanceledCalls(id)
+	if len(canceled) == 0 {
+		return
+	}
+
+	// delivering takes the lock that callers may hold
+	go func() {
+		for _, msg := range canceled {
+			r.deliver(msg)
+		}
+	}()
+}
+
+// removeFromBroker removes the session from the broker, which publishes its testaments in
+// the destroyed scope. They are delivered after the given publications.
+func (r *Realm) removeFromBroker(id uint64, publications ...*wampproto.Publication) {
+	destroyed, _ := r.broker.RemoveSessionWithTestaments(id)
+	r.publishLater(append(publications, destroyed...))
+}
+
+// publishLater delivers publications from a separate goroutine, so that callers may hold
+// the lock. They are delivered in order.
+func (r *Realm) publishLater(publications []*wampproto.Publication) {
+	if len(publications) == 0 {
+		return
+	}
+
+	go func() {
+		for _, publication := range publications {
+			r.publish(publication)
+		}
+	}()
+}
+
+// forgetResumeTokens must be called with the lock held.
+func (r *Realm) forgetResumeTokens(id uint64) {
+	for token, sessionID := range r.resumeTokens {
+		if sessionID == id {
+			delete(r.resumeTokens, token)
+		}
+	}
+}
+
+func (r *Realm) issueResumeToken(id uint64) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(data)
+
+	r.Lock()
+	defer r.Unlock()
+
+	if reserved, exists := r.reserved[id]; exists {
+		// a resuming client, its old token stays valid until it is attached
+		delete(r.resumeTokens, reserved.token)
+		reserved.token = token
+	} else {
+		r.forgetResumeTokens(id)
+	}
+
+	r.resumeTokens[token] = id
+	return token, nil
+}
+
+func (r *Realm) resume(token string) (*wampproto.SessionDetails, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	id, exists := r.resumeTokens[token]
+	if !exists {
+		return nil, false
+	}
+
+	// only one client at a time may resume a session
+	if _, reserved := r.reserved[id]; reserved {
+		return nil, false
+	}
+
+	var details *wampproto.SessionDetails
+	if suspended, exists := r.suspended[id]; exists {
+		details = suspended.details
+	} else if session, exists := r.sessions[id]; exists {
+		details = session.Details()
+	} else {
+		return nil, false
+	}
+
+	// the grace period must not run out between WELCOME and ResumeSession, the reservation
+	// is given up if the client isn't attached in time
+	reserved := &reservation{}
+	reserved.timer = time.AfterFunc(joinTimeout, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if r.reserved[id] == reserved {
+			r.cancelReservation(id)
+		}
+	})
+	r.reserved[id] = reserved
+
+	return details, true
+}
+
+func (r *Realm) HasSession(id uint64) bool {
+	r.RLock()
+	defer r.RUnlock()
+
+	_, exists := r.sessions[id]
+	return exists
+}
+
+// ReceiveMessage processes msg received from session sessionID and delivers the
+// resulting messages to their recipients.
+func (r *Realm) ReceiveMessage(sessionID uint64, msg messages.Message) error {
+	r.RLock()
+	session, exists := r.sessions[sessionID]
+	r.RUnlock()
+
+	// a suspended session has no connection it could send anything through
+	if !exists {
+		return fmt.Errorf("router: session %d not attached to realm %s", sessionID, r.name)
+	}
+
+	if session.Closing() {
+		// messages in flight when we sent GOODBYE are dropped, the GOODBYE reply
+		// completes the closing handshake
+		if msg.Type() == messages.MessageTypeGoodbye {
+			_ = r.DetachSession(sessionID)
+			session.Close()
+		}
+
+		return nil
+	}
+
+	switch msg.Type() {
+	case messages.MessageTypeCall:
+		if result, handled := r.handleMetaCall(sessionID, msg.(*messages.Call)); handled {
+			result.Recipient = sessionID
+			r.deliver(result)
+			return nil
+		}
+
+		result, err := r.dealer.ReceiveMessage(sessionID, msg)
+		if err != nil {
+			return err
+		}
+
+		r.deliver(result)
+	case messages.MessageTypeYield, messages.MessageTypeRegister, messages.MessageTypeUnregister:
+		result, err := r.dealer.ReceiveMessage(sessionID, msg)
+		if err != nil {
+			return err
+		}
+
+		r.deliver(result)
+	case messages.MessageTypeError:
+		errMsg := msg.(*messages.Error)
+		if errMsg.MessageType() != messages.MessageTypeInvocation {
+			return wampproto.NewProtocolViolationError("router: unexpected ERROR for message type %d",
+				errMsg.MessageType())
+		}
+
+		result, err := r.dealer.ReceiveMessage(sessionID, msg)
+		if err != nil {
+			return err
+		}
+
+		r.deliver(result)
+	case messages.MessageTypeSubscribe, messages.MessageTypeUnsubscribe:
+		result, err := r.broker.ReceiveMessage(sessionID, msg)
+		if err != nil {
+			return err
+		}
+
+		r.deliver(result)
+
+		if subscribe, ok := msg.(*messages.Subscribe); ok {
+			if getRetained, _ := subscribe.Options()[wampproto.OptGetRetained].(bool); getRetained {
+				subscribed := result.Message.(*messages.Subscribed)
+				retained, err := r.broker.RetainedEvents(sessionID, subscribed.SubscriptionID())
+				if err != nil {
+					return err
+				}
+
+				for _, event := range retained {
+					r.deliver(event)
+				}
+			}
+		}
+	case messages.MessageTypePublish:
+		publication, err := r.broker.ReceivePublish(sessionID, msg.(*messages.Publish))
+		if err != nil {
+			return err
+		}
+
+		r.publish(publication)
+	case messages.MessageTypeGoodbye:
+		// detach before replying so that no EVENT or INVOCATION gets queued after GOODBYE
+		if err := r.DetachSession(sessionID); err != nil {
+			return err
+		}
+
+		_ = session.Send(messages.NewGoodBye(wampproto.CloseGoodByeAndOut, nil))
+	default:
+		return wampproto.NewProtocolViolationError("router: unexpected message of type %T", msg)
+	}
+
+	return nil
+}
+
+func (r *Realm) publish(publication *wampproto.Publication) {
+	if publication.Event != nil {
+		for _, recipient := range publication.Recipients {
+			r.deliver(&wampproto.MessageWithRecipient{Message: publication.Event, Recipient: recipient})
+		}
+	}
+
+	if publication.Ack != nil {
+		r.deliver(publication.Ack)
+	}
+}
+
+func (r *Realm) deliver(msg *wampproto.MessageWithRecipient) {
+	if msg == nil {
+		return
+	}
+
+	r.RLock()
+	session, exists := r.sessions[msg.Recipient]
+	r.RUnlock()
+
+	if exists {
+		_ = session.Send(msg.Message)
+		return
+	}
+
+	if invocation, ok := msg.Message.(*messages.Invocation); ok {
+		r.Lock()
+		_, suspended := r.suspended[msg.Recipient]
+		r.Unlock()
+
+		// a suspended callee cannot answer, fail the call instead of leaving it pending
+		if suspended {
+			errMsg := messages.NewError(messages.MessageTypeInvocation, invocation.RequestID(), map[string]any{},
+				wampproto.ErrUnavailable, nil, nil)
+			result, err := r.dealer.ReceiveMessage(msg.Recipient, errMsg)
+			if err == nil {
+				r.deliver(result)
+			}
+		}
+
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	suspended, exists := r.suspended[msg.Recipient]
+	if !exists {
+		return
+	}
+
+	if len(suspended.buffered) == maxBufferedMessages {
+		suspended.timer.Stop()
+		r.removeSuspended(msg.Recipient)
+		return
+	}
+
+	suspended.buffered = append(suspended.buffered, msg.Message)
+}
+
+// Goodbye starts the closing handshake with session sessionID. The session stops
+// receiving routed messages right away and is detached once it replies.
+func (r *Realm) Goodbye(sessionID uint64, reason string) error {
+	r.RLock()
+	session, exists := r.sessions[sessionID]
+	r.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("router: session %d not attached to realm %s", sessionID, r.name)
+	}
+
+	detached, _ := r.broker.FireTestaments(sessionID, wampproto.TestamentScopeDetached)
+	r.removeFromDealer(sessionID)
+	r.removeFromBroker(sessionID, detached...)
+
+	return session.Send(messages.NewGoodBye(reason, nil))
+}
+
+// Close sends GOODBYE to all sessions and drops suspended sessions.
+func (r *Realm) Close() {
+	r.Lock()
+	ids := make([]uint64, 0, len(r.sessions))
+	for id := range r.sessions {
+		ids = append(ids, id)
+	}
+
+	for id, suspended := range r.suspended {
+		suspended.timer.Stop()
+		r.removeSuspended(id)
+	}
+	r.Unlock()
+
+	for _, id := range ids {
+		_ = r.Goodbye(id, wampproto.CloseSystemShutdown)
+	}
+}
@@ -0,0 +1,88 @@
+package router
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Router holds the realms served by a Server.
+type Router struct {
+	realms map[string]*Realm
+	sync.RWMutex
+}
+
+func NewRouter() *Router {
+	return &Router{
+		realms: make(map[string]*Realm),
+	}
+}
+
+func (r *Router) AddRealm(name string) (*Realm, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, exists := r.realms[name]; exists {
+		return nil, fmt.Errorf("router: realm %s already exists", name)
+	}
+
+	realm := NewRealm(name)
+	r.realms[name] = realm
+	return realm, nil
+}
+
+func (r *Router) RemoveRealm(name string) error {
+	r.Lock()
+	realm, exists := r.realms[name]
+	delete(r.realms, name)
+	r.Unlock()
+
+	if !exists {
+		return fmt.Errorf("router: realm %s does not exist", name)
+	}
+
+	realm.Close()
+	return nil
+}
+
+func (r *Router) Realm(name string) (*Realm, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	realm, exists := r.realms[name]
+	return realm, exists
+}
+
+func (r *Router) HasRealm(name string) bool {
+	_, exists := r.Realm(name)
+	return exists
+}
+
+// ResolveRealm makes the router a wampproto.RealmRegistry of its realms.
+func (r *Router) ResolveRealm(name string) (string, bool) {
+	return name, r.HasRealm(name)
+}
+
+// CreateRealm adds the realm unless it exists already, so that concurrent joins to a
+// realm that is created on first join all succeed.
+func (r *Router) CreateRealm(name string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, exists := r.realms[name]; !exists {
+		r.realms[name] = NewRealm(name)
+	}
+
+	return nil
+}
+
+// Close closes all realms, sending GOODBYE to every attached session.
+func (r *Router) Close() {
+	r.Lock()
+	realms := r.realms
+	r.realms = make(map[string]*Realm)
+	r.Unlock()
+
+	for _, realm := range realms {
+		realm.Close()
+	}
+}
@@ -0,0 +1,439 @@
+package router_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/client"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/router"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+)
+
+const testRealm = "realm1"
+
+func startServer(t *testing.T, network, address string, configure ...func(*router.Server)) (*router.Router, string) {
+	r := router.NewRouter()
+	_, err := r.AddRealm(testRealm)
+	require.NoError(t, err)
+
+	listener, err := net.Listen(network, address)
+	require.NoError(t, err)
+
+	server := router.NewServer(r, nil)
+	for _, fn := range configure {
+		fn(server)
+	}
+
+	go func() { _ = server.Serve(listener) }()
+
+	t.Cleanup(func() {
+		_ = server.Close()
+		r.Close()
+	})
+
+	return r, listener.Addr().String()
+}
+
+func connect(t *testing.T, url, realm string) (*client.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	c, err := client.Connect(ctx, url, realm, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() { _ = c.Close() })
+	return c, nil
+}
+
+func TestRouterRPC(t *testing.T) {
+	_, address := startServer(t, "tcp", "127.0.0.1:0")
+	callee, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+	caller, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = callee.Register(ctx, "io.xconn.echo", func(_ context.Context,
+		invocation *messages.Invocation) ([]any, map[string]any, error) {
+		return invocation.Args(), invocation.KwArgs(), nil
+	}, nil)
+	require.NoError(t, err)
+
+	result, err := caller.Call(ctx, "io.xconn.echo", []any{"hello"}, map[string]any{"key": "value"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []any{"hello"}, result.Args())
+	require.Equal(t, map[string]any{"key": "value"}, result.KwArgs())
+}
+
+func TestRouterCalleeLeaves(t *testing.T) {
+	_, address := startServer(t, "tcp", "127.0.0.1:0")
+	callee, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+	caller, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	invoked := make(chan struct{})
+	_, err = callee.Register(ctx, "io.xconn.hang", func(ctx context.Context,
+		_ *messages.Invocation) ([]any, map[string]any, error) {
+		close(invoked)
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	}, nil)
+	require.NoError(t, err)
+
+	go func() {
+		<-invoked
+		_ = callee.Close()
+	}()
+
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = caller.Call(callCtx, "io.xconn.hang", nil, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), wampproto.ErrCanceled)
+}
+
+func TestRouterPubSub(t *testing.T) {
+	_, address := startServer(t, "unix", filepath.Join(t.TempDir(), "router.sock"))
+	subscriber, err := connect(t, "unix://"+address, testRealm)
+	require.NoError(t, err)
+	publisher, err := connect(t, "unix://"+address, testRealm)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	events := make(chan *messages.Event, 1)
+	_, err = subscriber.Subscribe(ctx, "io.xconn.topic", func(event *messages.Event) {
+		events <- event
+	}, nil)
+	require.NoError(t, err)
+
+	err = publisher.Publish(ctx, "io.xconn.topic", []any{"hello"}, nil, map[string]any{"acknowledge": true})
+	require.NoError(t, err)
+
+	select {
+	case event := <-events:
+		require.Equal(t, []any{"hello"}, event.Args())
+	case <-time.After(time.Second):
+		require.FailNow(t, "event not received")
+	}
+}
+
+func TestRouterNoSuchRealm(t *testing.T) {
+	_, address := startServer(t, "tcp", "127.0.0.1:0")
+	_, err := connect(t, "rs://"+address, "unknown")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wamp.error.no_such_realm")
+}
+
+func TestRouterAutoCreateRealms(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0", func(s *router.Server) {
+		s.SetAutoCreateRealms(true)
+	})
+
+	c, err := connect(t, "rs://"+address, "realm2")
+	require.NoError(t, err)
+
+	realm, exists := r.Realm("realm2")
+	require.True(t, exists)
+	require.True(t, realm.HasSession(c.SessionDetails().ID()))
+}
+
+func TestRouterGoodbye(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0")
+	c, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	realm, _ := r.Realm(testRealm)
+	require.True(t, realm.HasSession(c.SessionDetails().ID()))
+
+	require.NoError(t, c.Leave())
+	require.Eventually(t, func() bool {
+		return !realm.HasSession(c.SessionDetails().ID())
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRouterShutdownGoodbye(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0")
+	c, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	realm, _ := r.Realm(testRealm)
+	require.NoError(t, r.RemoveRealm(testRealm))
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		require.FailNow(t, "client not disconnected")
+	}
+
+	require.Eventually(t, func() bool {
+		return !realm.HasSession(c.SessionDetails().ID())
+	}, time.Second, 10*time.Millisecond)
+}
+
+// join joins the realm over a raw connection, so the test drives the WAMP session directly.
+func join(t *testing.T, address string, joiner *wampproto.Joiner) (transports.Peer, *wampproto.SessionDetails) {
+	peer, err := transports.DialRawSocket(context.Background(), "tcp", address, transports.SerializerJson,
+		transports.DefaultMaxMsgSize)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = peer.Close() })
+
+	toSend, err := joiner.SendHello()
+	require.NoError(t, err)
+	for toSend != nil {
+		require.NoError(t, peer.Write(toSend))
+		payload, err := peer.Read()
+		require.NoError(t, err)
+		toSend, err = joiner.Receive(payload)
+		require.NoError(t, err)
+	}
+
+	details, err := joiner.SessionDetails()
+	require.NoError(t, err)
+	return peer, details
+}
+
+func TestRouterSessionResumption(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0", func(server *router.Server) {
+		server.EnableSessionResumption(200 * time.Millisecond)
+	})
+	realm, _ := r.Realm(testRealm)
+	publisher, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	joiner := wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+	joiner.SetResumable(true)
+	peer, details := join(t, address, joiner)
+	require.False(t, details.Resumed())
+	require.NotEmpty(t, details.ResumeToken())
+
+	session := wampproto.NewSession(&serializers.JSONSerializer{})
+	toSend, err := session.SendMessage(session.NewSubscribe(nil, "io.xconn.topic"))
+	require.NoError(t, err)
+	require.NoError(t, peer.Write(toSend))
+	payload, err := peer.Read()
+	require.NoError(t, err)
+	_, err = session.Receive(payload)
+	require.NoError(t, err)
+
+	// lose the connection and publish while the session is suspended
+	require.NoError(t, peer.Close())
+	require.Eventually(t, func() bool {
+		return !realm.HasSession(details.ID())
+	}, time.Second, 10*time.Millisecond)
+
+	err = publisher.Publish(context.Background(), "io.xconn.topic", []any{"hello"}, nil,
+		map[string]any{"acknowledge": true})
+	require.NoError(t, err)
+
+	joiner = wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+	joiner.SetResumeToken(details.ResumeToken())
+	peer, resumed := join(t, address, joiner)
+	require.True(t, resumed.Resumed())
+	require.Equal(t, details.ID(), resumed.ID())
+	require.NotEqual(t, details.ResumeToken(), resumed.ResumeToken())
+
+	payload, err = peer.Read()
+	require.NoError(t, err)
+	msg, err := session.Receive(payload)
+	require.NoError(t, err)
+	event, ok := msg.(*messages.Event)
+	require.True(t, ok)
+	require.Equal(t, []any{"hello"}, event.Args())
+
+	t.Run("Expired", func(t *testing.T) {
+		require.NoError(t, peer.Close())
+		time.Sleep(400 * time.Millisecond)
+
+		joiner = wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+		joiner.SetResumeToken(resumed.ResumeToken())
+		_, expired := join(t, address, joiner)
+		require.False(t, expired.Resumed())
+		require.NotEqual(t, details.ID(), expired.ID())
+	})
+}
+
+func TestRouterGoodbyeSuspended(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0", func(server *router.Server) {
+		server.EnableSessionResumption(time.Second)
+	})
+	realm, _ := r.Realm(testRealm)
+
+	joiner := wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+	joiner.SetResumable(true)
+	peer, details := join(t, address, joiner)
+	require.NoError(t, peer.Close())
+	require.Eventually(t, func() bool {
+		return !realm.HasSession(details.ID())
+	}, time.Second, 10*time.Millisecond)
+
+	err := realm.ReceiveMessage(details.ID(), messages.NewGoodBye(wampproto.CloseCloseRealm, nil))
+	require.Error(t, err)
+
+	// the suspended session is left alone
+	joiner = wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+	joiner.SetResumeToken(details.ResumeToken())
+	_, resumed := join(t, address, joiner)
+	require.True(t, resumed.Resumed())
+}
+
+func TestRouterSessionTakeover(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0", func(server *router.Server) {
+		server.EnableSessionResumption(time.Second)
+	})
+	realm, _ := r.Realm(testRealm)
+
+	joiner := wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+	joiner.SetResumable(true)
+	oldPeer, details := join(t, address, joiner)
+
+	// resume before the router noticed the old connection is gone
+	joiner = wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+	joiner.SetResumeToken(details.ResumeToken())
+	_, resumed := join(t, address, joiner)
+	require.True(t, resumed.Resumed())
+	require.Equal(t, details.ID(), resumed.ID())
+
+	_, err := oldPeer.Read()
+	require.Error(t, err)
+
+	// the old connection going away leaves the resumed session alone
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, realm.HasSession(details.ID()))
+
+	// the used token is gone, the new one works
+	joiner = wampproto.NewJoiner(testRealm, &serializers.JSONSerializer{}, nil)
+	joiner.SetResumeToken(details.ResumeToken())
+	_, rejected := join(t, address, joiner)
+	require.False(t, rejected.Resumed())
+}
+
+func TestRouterRetainedEventsAndHistory(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0")
+	realm, _ := r.Realm(testRealm)
+	realm.EnableEventHistory(10)
+
+	publisher, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+	subscriber, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	options := map[string]any{"acknowledge": true, wampproto.OptRetain: true}
+	err = publisher.Publish(ctx, "io.xconn.state", []any{"on"}, nil, options)
+	require.NoError(t, err)
+
+	events := make(chan *messages.Event, 1)
+	subscriptionID, err := subscriber.Subscribe(ctx, "io.xconn.state", func(event *messages.Event) {
+		events <- event
+	}, map[string]any{wampproto.OptGetRetained: true})
+	require.NoError(t, err)
+
+	select {
+	case event := <-events:
+		require.Equal(t, []any{"on"}, event.Args())
+		require.Equal(t, true, event.Details()[wampproto.DetailRetained])
+	case <-time.After(time.Second):
+		require.FailNow(t, "retained event not received")
+	}
+
+	err = publisher.Publish(ctx, "io.xconn.state", []any{"off"}, nil, map[string]any{"acknowledge": true})
+	require.NoError(t, err)
+
+	result, err := subscriber.Call(ctx, wampproto.MetaProcSubscriptionGetEvents, []any{subscriptionID}, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Args(), 2)
+	require.Equal(t, []any{"on"}, result.Args()[0].(map[string]any)["args"])
+	require.Equal(t, []any{"off"}, result.Args()[1].(map[string]any)["args"])
+
+	_, err = subscriber.Call(ctx, wampproto.MetaProcSubscriptionGetEvents, []any{12345}, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), wampproto.ErrNoSuchSubscription)
+}
+
+func TestRouterTestament(t *testing.T) {
+	_, address := startServer(t, "tcp", "127.0.0.1:0")
+	subscriber, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+	device, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	events := make(chan *messages.Event, 3)
+	_, err = subscriber.Subscribe(ctx, "io.xconn.device.offline", func(event *messages.Event) {
+		events <- event
+	}, nil)
+	require.NoError(t, err)
+
+	addTestament := func(name string, kwArgs map[string]any) {
+		_, err := device.Call(ctx, wampproto.MetaProcSessionAddTestament,
+			[]any{"io.xconn.device.offline", []any{name}, map[string]any{}}, kwArgs, nil)
+		require.NoError(t, err)
+	}
+
+	addTestament("flushed", nil)
+	result, err := device.Call(ctx, wampproto.MetaProcSessionFlushTestaments, nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []any{float64(1)}, result.Args())
+
+	addTestament("device1", nil)
+	addTestament("detached", map[string]any{
+		"scope":           wampproto.TestamentScopeDetached,
+		"publish_options": map[string]any{"retain": true},
+	})
+	require.NoError(t, device.Close())
+
+	// the client runs each event handler in its own goroutine, so the order is not kept
+	var received []any
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-events:
+			received = append(received, event.Args()...)
+		case <-time.After(time.Second):
+			require.FailNow(t, "testament not received")
+		}
+	}
+	require.ElementsMatch(t, []any{"detached", "device1"}, received)
+
+	select {
+	case event := <-events:
+		require.FailNow(t, "unexpected event", event.Args())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type denyMetaAuthorizer struct{}
+
+func (a *denyMetaAuthorizer) Authorize(_ *wampproto.SessionDetails, msg messages.Message) (bool, error) {
+	call, ok := msg.(*messages.Call)
+	return !ok || call.Procedure() != wampproto.MetaProcSessionAddTestament, nil
+}
+
+func TestRouterMetaAuthorization(t *testing.T) {
+	r, address := startServer(t, "tcp", "127.0.0.1:0")
+	realm, _ := r.Realm(testRealm)
+	realm.SetAuthorizer(&denyMetaAuthorizer{})
+
+	device, err := connect(t, "rs://"+address, testRealm)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = device.Call(ctx, wampproto.MetaProcSessionAddTestament,
+		[]any{"io.xconn.device.offline", []any{}, map[string]any{}}, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), wampproto.ErrNotAuthorized)
+
+	_, err = device.Call(ctx, wampproto.MetaProcSessionFlushTestaments, nil, nil, nil)
+	require.NoError(t, err)
+}
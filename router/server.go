@@ -0,0 +1,296 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+)
+
+const joinTimeout = 10 * time.Second
+
+// Server accepts rawsocket connections and joins them to the realms of a Router.
+type Server struct {
+	router        *Router
+	authenticator auth.ServerAuthenticator
+
+	maxMessageSize    int
+	writeQueueSize    int
+	resumeGracePeriod time.Duration
+	autoCreateRealms  bool
+
+	listeners map[net.Listener]struct{}
+	sync.Mutex
+}
+
+func NewServer(router *Router, authenticator auth.ServerAuthenticator) *Server {
+	return &Server{
+		router:         router,
+		authenticator:  authenticator,
+		maxMessageSize: transports.DefaultMaxMsgSize,
+		writeQueueSize: DefaultWriteQueueSize,
+		listeners:      make(map[net.Listener]struct{}),
+	}
+}
+
+// EnableSessionResumption lets clients that ask for it in HELLO resume their session after
+// losing the connection. The session's registrations and subscriptions are kept for
+// gracePeriod and messages routed to it meanwhile are delivered once it resumes.
+func (s *Server) EnableSessionResumption(gracePeriod time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.resumeGracePeriod = gracePeriod
+}
+
+// SetAutoCreateRealms sets whether clients joining a realm that doesn't exist create it
+// instead of getting ABORT wamp.error.no_such_realm.
+func (s *Server) SetAutoCreateRealms(enabled bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.autoCreateRealms = enabled
+}
+
+// ListenAndServe listens on the given network ("tcp" or "unix") and address and serves
+// connections until the listener is closed.
+func (s *Server) ListenAndServe(network, address string) error {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	s.Lock()
+	s.listeners[listener] = struct{}{}
+	s.Unlock()
+
+	defer func() {
+		s.Lock()
+		delete(s.listeners, listener)
+		s.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// Close stops all listeners. Already established sessions stay connected until the
+// router is closed.
+func (s *Server) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	var errs []error
+	for listener := range s.listeners {
+		errs = append(errs, listener.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(joinTimeout))
+	peer, serializerID, err := transports.AcceptRawSocket(conn, s.maxMessageSize, isSupportedSerializer)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	s.Lock()
+	gracePeriod := s.resumeGracePeriod
+	autoCreateRealms := s.autoCreateRealms
+	s.Unlock()
+
+	serializer, _ := serializerByID(serializerID)
+	details, err := s.join(peer, serializer, gracePeriod > 0, autoCreateRealms)
+	if err != nil {
+		_ = peer.Close()
+		return
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	realm, exists := s.router.Realm(details.Realm())
+	if !exists {
+		// the realm was removed after the client was welcomed
+		abort := messages.NewAbort(nil, wampproto.ErrNoSuchRealm, []any{details.Realm()}, nil)
+		if toSend, err := serializer.Serialize(abort); err == nil {
+			_ = peer.Write(toSend)
+		}
+
+		_ = peer.Close()
+		return
+	}
+
+	session := NewSession(details, peer, serializer, s.writeQueueSize)
+	if details.Resumed() {
+		err = realm.ResumeSession(session)
+	} else {
+		err = realm.AttachSession(session)
+	}
+
+	if err != nil {
+		session.Close()
+		return
+	}
+
+	defer func() {
+		// a resumable session that lost its connection is kept for the grace period
+		if details.ResumeToken() == "" {
+			realm.releaseSession(session, 0)
+		} else {
+			realm.releaseSession(session, gracePeriod)
+		}
+
+		session.Close()
+	}()
+
+	for {
+		payload, err := peer.Read()
+		if err != nil {
+			return
+		}
+
+		msg, err := serializer.Deserialize(payload)
+		if err != nil {
+			err = wampproto.NewProtocolViolationError("failed to deserialize message: %w", err)
+		} else {
+			err = realm.ReceiveMessage(session.ID(), msg)
+		}
+
+		if err != nil {
+			realm.releaseSession(session, 0)
+			if abort := wampproto.NewAbortFromError(err); abort != nil {
+				_ = session.Send(abort)
+				<-session.Done()
+			}
+
+			return
+		}
+
+		if msg.Type() == messages.MessageTypeGoodbye {
+			<-session.Done()
+			return
+		}
+	}
+}
+
+func (s *Server) join(peer transports.Peer, serializer serializers.Serializer,
+	resumable, autoCreateRealms bool) (*wampproto.SessionDetails, error) {
+	acceptor := wampproto.NewAcceptorWithOptions(serializer, s.authenticator, &wampproto.AcceptorOptions{
+		RealmRoles:       s.realmRoles,
+		RealmRegistry:    s.router,
+		AutoCreateRealms: autoCreateRealms,
+	})
+	if resumable {
+		acceptor.SetSessionStore(&sessionStore{router: s.router})
+	}
+	for {
+		payload, err := peer.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		toSend, welcomed, err := acceptor.Receive(payload)
+		if err != nil {
+			if abort := wampproto.NewAbortFromError(err); abort != nil {
+				toSend, _ = serializer.Serialize(abort)
+				_ = peer.Write(toSend)
+			}
+
+			return nil, err
+		}
+
+		if welcomed {
+			details, err := acceptor.SessionDetails()
+			if err != nil {
+				return nil, err
+			}
+
+			if !s.router.HasRealm(details.Realm()) {
+				abort := messages.NewAbort(nil, wampproto.ErrNoSuchRealm, []any{details.Realm()}, nil)
+				toSend, _ = serializer.Serialize(abort)
+				_ = peer.Write(toSend)
+				return nil, fmt.Errorf("router: no such realm %s", details.Realm())
+			}
+
+			return details, peer.Write(toSend)
+		}
+
+		if err = peer.Write(toSend); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// realmRoles announces what the dealer and broker of the joined realm support.
+func (s *Server) realmRoles(realm string) map[string]any {
+	r, exists := s.router.Realm(realm)
+	if !exists {
+		return wampproto.DefaultRouterRoles()
+	}
+
+	return r.Roles()
+}
+
+// sessionStore hands out resume tokens for the sessions of the router's realms.
+type sessionStore struct {
+	router *Router
+}
+
+func (s *sessionStore) IssueToken(realm string, sessionID uint64) (string, error) {
+	r, exists := s.router.Realm(realm)
+	if !exists {
+		return "", fmt.Errorf("router: no such realm %s", realm)
+	}
+
+	return r.issueResumeToken(sessionID)
+}
+
+func (s *sessionStore) Resume(realm, token string) (*wampproto.SessionDetails, bool) {
+	r, exists := s.router.Realm(realm)
+	if !exists {
+		return nil, false
+	}
+
+	return r.resume(token)
+}
+
+func isSupportedSerializer(serializer transports.Serializer) bool {
+	_, err := serializerByID(serializer)
+	return err == nil
+}
+
+func serializerByID(serializer transports.Serializer) (serializers.Serializer, error) {
+	switch serializer {
+	case transports.SerializerJson:
+		return &serializers.JSONSerializer{}, nil
+	case transports.SerializerMsgpack:
+		return &serializers.MsgPackSerializer{}, nil
+	case transports.SerializerCbor:
+		return &serializers.CBORSerializer{}, nil
+	default:
+		return nil, fmt.Errorf("router: unsupported serializer %d", serializer)
+	}
+}
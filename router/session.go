@@ -0,0 +1,156 @@
+package router
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+)
+
+const (
+	DefaultWriteQueueSize = 64
+
+	// goodbyeTimeout is how long the router waits for the reply to its GOODBYE before
+	// closing the connection.
+	goodbyeTimeout = 5 * time.Second
+)
+
+var (
+	ErrSessionClosed  = errors.New("router: session closed")           //nolint:gochecknoglobals
+	ErrSessionClosing = errors.New("router: session closing")          //nolint:gochecknoglobals
+	ErrWriteQueueFull = errors.New("router: session write queue full") //nolint:gochecknoglobals
+)
+
+// Session is a joined client connection. Messages sent to it are queued and written
+// by a dedicated goroutine, so a slow connection never blocks message routing.
+type Session struct {
+	details    *wampproto.SessionDetails
+	peer       transports.Peer
+	serializer serializers.Serializer
+
+	queue       chan messages.Message
+	done        chan struct{}
+	closeOnce   sync.Once
+	goodbyeSent bool
+	sync.Mutex
+}
+
+func NewSession(details *wampproto.SessionDetails, peer transports.Peer, serializer serializers.Serializer,
+	queueSize int) *Session {
+	if queueSize <= 0 {
+		queueSize = DefaultWriteQueueSize
+	}
+
+	session := &Session{
+		details:    details,
+		peer:       peer,
+		serializer: serializer,
+		queue:      make(chan messages.Message, queueSize),
+		done:       make(chan struct{}),
+	}
+
+	go session.writeLoop()
+
+	return session
+}
+
+func (s *Session) ID() uint64 {
+	return s.details.ID()
+}
+
+func (s *Session) Details() *wampproto.SessionDetails {
+	return s.details
+}
+
+// Send queues msg for writing. A session whose queue is full is considered too slow
+// to keep up and gets disconnected. Once the router sent GOODBYE, nothing else is sent;
+// the connection is closed when the client replies or after goodbyeTimeout.
+func (s *Session) Send(msg messages.Message) error {
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+
+	s.Lock()
+	if s.goodbyeSent {
+		s.Unlock()
+		return ErrSessionClosing
+	}
+
+	if msg.Type() == messages.MessageTypeGoodbye && !isFinal(msg) {
+		s.goodbyeSent = true
+		time.AfterFunc(goodbyeTimeout, s.Close)
+	}
+	s.Unlock()
+
+	select {
+	case s.queue <- msg:
+		return nil
+	default:
+		s.Close()
+		return ErrWriteQueueFull
+	}
+}
+
+// Closing reports whether the router sent GOODBYE and waits for the client's reply.
+func (s *Session) Closing() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.goodbyeSent
+}
+
+// Done returns a channel that is closed once the session is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.peer.Close()
+	})
+}
+
+func (s *Session) writeLoop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.queue:
+			data, err := s.serializer.Serialize(msg)
+			if err != nil {
+				s.Close()
+				return
+			}
+
+			if err = s.peer.Write(data); err != nil {
+				s.Close()
+				return
+			}
+
+			if isFinal(msg) {
+				s.Close()
+				return
+			}
+		}
+	}
+}
+
+// isFinal reports whether msg is the last message written to a connection: an ABORT
+// or the GOODBYE sent in reply to the client's GOODBYE.
+func isFinal(msg messages.Message) bool {
+	switch msg := msg.(type) {
+	case *messages.Abort:
+		return true
+	case *messages.GoodBye:
+		return msg.Reason() == wampproto.CloseGoodByeAndOut
+	default:
+		return false
+	}
+}
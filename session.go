@@ -2,20 +2,37 @@ package wampproto
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/xconnio/wampproto-go/internal"
 	"github.com/xconnio/wampproto-go/messages"
 	"github.com/xconnio/wampproto-go/serializers"
 )
 
+type sessionState uint
+
+const (
+	sessionStateEstablished sessionState = iota
+	// GOODBYE was sent, waiting for the peer to reply.
+	sessionStateClosing
+	// GOODBYE was received, the only message that may be sent is the GOODBYE reply.
+	sessionStateGoodbyeReceived
+	sessionStateClosed
+)
+
 type Session struct {
 	serializer serializers.Serializer
+	idGen      *SessionScopeIDGenerator
+	state      sessionState
 
 	// data structures for RPC
-	callRequests       internal.Map[uint64, struct{}]
+	// callRequests maps the request ID of pending calls to whether the call is a progressive
+	// call invocation that may still be continued with the same request ID, likewise
+	// invocationRequests tracks progressive invocations the dealer may still continue.
+	callRequests       internal.Map[uint64, bool]
 	registerRequests   internal.Map[uint64, struct{}]
 	registrations      internal.Map[uint64, struct{}]
-	invocationRequests internal.Map[uint64, struct{}]
+	invocationRequests internal.Map[uint64, bool]
 	unregisterRequests internal.Map[uint64, uint64]
 
 	// data structures for PubSub
@@ -23,6 +40,8 @@ type Session struct {
 	subscribeRequests   internal.Map[uint64, struct{}]
 	subscriptions       internal.Map[uint64, struct{}]
 	unsubscribeRequests internal.Map[uint64, uint64]
+
+	sync.Mutex
 }
 
 func NewSession(serializer serializers.Serializer) *Session {
@@ -32,11 +51,12 @@ func NewSession(serializer serializers.Serializer) *Session {
 
 	return &Session{
 		serializer: serializer,
+		idGen:      &SessionScopeIDGenerator{},
 
-		callRequests:       internal.Map[uint64, struct{}]{},
+		callRequests:       internal.Map[uint64, bool]{},
 		registerRequests:   internal.Map[uint64, struct{}]{},
 		registrations:      internal.Map[uint64, struct{}]{},
-		invocationRequests: internal.Map[uint64, struct{}]{},
+		invocationRequests: internal.Map[uint64, bool]{},
 		unregisterRequests: internal.Map[uint64, uint64]{},
 
 		publishRequests:     internal.Map[uint64, struct{}]{},
@@ -46,7 +66,190 @@ func NewSession(serializer serializers.Serializer) *Session {
 	}
 }
 
+// nextRequestID returns a request ID from the session scope generator, skipping
+// IDs that are still in use by pending requests.
+func (w *Session) nextRequestID() uint64 {
+	for {
+		requestID := w.idGen.NextID()
+		if !w.requestPending(requestID) {
+			return requestID
+		}
+	}
+}
+
+func (w *Session) requestPending(requestID uint64) bool {
+	return w.callRequests.Exists(requestID) ||
+		w.registerRequests.Exists(requestID) ||
+		w.unregisterRequests.Exists(requestID) ||
+		w.publishRequests.Exists(requestID) ||
+		w.subscribeRequests.Exists(requestID) ||
+		w.unsubscribeRequests.Exists(requestID)
+}
+
+func (w *Session) NewCall(options map[string]any, procedure string, args []any,
+	kwArgs map[string]any) *messages.Call {
+	return messages.NewCall(w.nextRequestID(), options, procedure, args, kwArgs)
+}
+
+func (w *Session) NewRegister(options map[string]any, procedure string) *messages.Register {
+	return messages.NewRegister(w.nextRequestID(), options, procedure)
+}
+
+func (w *Session) NewUnregister(registrationID uint64) *messages.Unregister {
+	return messages.NewUnregister(w.nextRequestID(), registrationID)
+}
+
+func (w *Session) NewPublish(options map[string]any, topic string, args []any,
+	kwArgs map[string]any) *messages.Publish {
+	return messages.NewPublish(w.nextRequestID(), options, topic, args, kwArgs)
+}
+
+func (w *Session) NewSubscribe(options map[string]any, topic string) *messages.Subscribe {
+	return messages.NewSubscribe(w.nextRequestID(), options, topic)
+}
+
+func (w *Session) NewUnsubscribe(subscriptionID uint64) *messages.Unsubscribe {
+	return messages.NewUnsubscribe(w.nextRequestID(), subscriptionID)
+}
+
+func (w *Session) checkRequestID(requestID uint64) error {
+	if w.requestPending(requestID) {
+		return fmt.Errorf("request ID %d is already in use by a pending request", requestID)
+	}
+
+	return nil
+}
+
+// Closing reports whether GOODBYE was sent and the session waits for the peer's reply.
+func (w *Session) Closing() bool {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.state == sessionStateClosing
+}
+
+// Closed reports whether the closing handshake completed or the session was aborted.
+func (w *Session) Closed() bool {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.state == sessionStateClosed
+}
+
+// checkSend validates that msg may be sent in the current state. The caller must hold the
+// session lock.
+func (w *Session) checkSend(msg messages.Message) error {
+	switch w.state {
+	case sessionStateClosed:
+		return fmt.Errorf("cannot send %T, session is closed", msg)
+	case sessionStateClosing:
+		return fmt.Errorf("cannot send %T, GOODBYE was already sent", msg)
+	case sessionStateGoodbyeReceived:
+		if msg.Type() != messages.MessageTypeGoodbye {
+			return fmt.Errorf("cannot send %T, peer sent GOODBYE", msg)
+		}
+	}
+
+	return nil
+}
+
+// transitionOnSend applies the state change caused by sending msg. The caller must hold
+// the session lock and have validated msg with checkSend.
+func (w *Session) transitionOnSend(msg messages.Message) {
+	if msg.Type() != messages.MessageTypeGoodbye {
+		return
+	}
+
+	switch w.state {
+	case sessionStateGoodbyeReceived:
+		w.state = sessionStateClosed
+	case sessionStateEstablished:
+		w.state = sessionStateClosing
+	}
+}
+
+// transitionOnReceive validates that msg may be received in the current state and
+// applies the state change caused by receiving it.
+func (w *Session) transitionOnReceive(msg messages.Message) error {
+	w.Lock()
+	defer w.Unlock()
+
+	switch w.state {
+	case sessionStateClosed, sessionStateGoodbyeReceived:
+		return NewProtocolViolationError("received %T after GOODBYE", msg)
+	case sessionStateClosing:
+		// messages that were in flight when GOODBYE was sent are still processed
+		if msg.Type() == messages.MessageTypeGoodbye || msg.Type() == messages.MessageTypeAbort {
+			w.state = sessionStateClosed
+		}
+	case sessionStateEstablished:
+		switch msg.Type() {
+		case messages.MessageTypeGoodbye:
+			w.state = sessionStateGoodbyeReceived
+		case messages.MessageTypeAbort:
+			w.state = sessionStateClosed
+		}
+	}
+
+	return nil
+}
+
+// SendMessage validates msg against the session state and returns its serialized form.
+// Once GOODBYE was sent, no other message may be sent; once GOODBYE was received,
+// the only message allowed is the GOODBYE reply.
 func (w *Session) SendMessage(msg messages.Message) ([]byte, error) {
+	// the lock is held until the request ID is stored, so concurrent sends can't both
+	// pass the check for the same ID
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.checkSend(msg); err != nil {
+		return nil, err
+	}
+
+	data, err := w.sendMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	w.transitionOnSend(msg)
+	return data, nil
+}
+
+// sendMessage checks msg against the pending requests, serializes it and records it. The
+// caller must hold the session lock.
+func (w *Session) sendMessage(msg messages.Message) ([]byte, error) {
+	switch msg.Type() {
+	case messages.MessageTypeCall:
+		call := msg.(*messages.Call)
+		continuation, exists := w.callRequests.Load(call.RequestID())
+		if !exists || !continuation {
+			if err := w.checkRequestID(call.RequestID()); err != nil {
+				return nil, err
+			}
+		}
+	case messages.MessageTypeRegister:
+		if err := w.checkRequestID(msg.(*messages.Register).RequestID()); err != nil {
+			return nil, err
+		}
+	case messages.MessageTypeUnregister:
+		if err := w.checkRequestID(msg.(*messages.Unregister).RequestID()); err != nil {
+			return nil, err
+		}
+	case messages.MessageTypePublish:
+		if err := w.checkRequestID(msg.(*messages.Publish).RequestID()); err != nil {
+			return nil, err
+		}
+	case messages.MessageTypeSubscribe:
+		if err := w.checkRequestID(msg.(*messages.Subscribe).RequestID()); err != nil {
+			return nil, err
+		}
+	case messages.MessageTypeUnsubscribe:
+		if err := w.checkRequestID(msg.(*messages.Unsubscribe).RequestID()); err != nil {
+			return nil, err
+		}
+	}
+
 	data, err := w.serializer.Serialize(msg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize message: %w", err)
@@ -55,11 +258,16 @@ func (w *Session) SendMessage(msg messages.Message) ([]byte, error) {
 	switch msg.Type() {
 	case messages.MessageTypeCall:
 		call := msg.(*messages.Call)
-		w.callRequests.Store(call.RequestID(), struct{}{})
+		progress, _ := call.Options()[OptionProgress].(bool)
+		w.callRequests.Store(call.RequestID(), progress)
 
 		return data, nil
 	case messages.MessageTypeYield:
 		yield := msg.(*messages.Yield)
+		if !w.invocationRequests.Exists(yield.RequestID()) {
+			return nil, fmt.Errorf("cannot yield for unknown invocation request %d", yield.RequestID())
+		}
+
 		progress, _ := yield.Options()[OptionProgress].(bool)
 		if !progress {
 			w.invocationRequests.Delete(yield.RequestID())
@@ -106,7 +314,11 @@ func (w *Session) SendMessage(msg messages.Message) ([]byte, error) {
 			return nil, fmt.Errorf("send only supported for invocation error")
 		}
 
-		w.invocationRequests.Delete(errorMsg.RequestID())
+		_, exists := w.invocationRequests.LoadAndDelete(errorMsg.RequestID())
+		if !exists {
+			return nil, fmt.Errorf("cannot send error for unknown invocation request %d", errorMsg.RequestID())
+		}
+
 		return data, nil
 	case messages.MessageTypeGoodbye:
 		return data, nil
@@ -118,19 +330,25 @@ func (w *Session) SendMessage(msg messages.Message) ([]byte, error) {
 func (w *Session) Receive(data []byte) (messages.Message, error) {
 	msg, err := w.serializer.Deserialize(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to deserialize message: %w", err)
+		return nil, NewProtocolViolationError("failed to deserialize message: %w", err)
 	}
 
 	return w.ReceiveMessage(msg)
 }
 
+// ReceiveMessage validates msg received from the router against the session state. When
+// GOODBYE is received, the caller must reply with GOODBYE carrying wamp.close.goodbye_and_out.
 func (w *Session) ReceiveMessage(msg messages.Message) (messages.Message, error) {
+	if err := w.transitionOnReceive(msg); err != nil {
+		return nil, err
+	}
+
 	switch msg.Type() {
 	case messages.MessageTypeResult:
 		result := msg.(*messages.Result)
 		_, exists := w.callRequests.Load(result.RequestID())
 		if !exists {
-			return nil, fmt.Errorf("received RESULT for invalid requestID")
+			return nil, NewProtocolViolationError("received RESULT for invalid requestID")
 		}
 
 		progress, _ := result.Details()[OptionProgress].(bool)
@@ -143,21 +361,21 @@ func (w *Session) ReceiveMessage(msg messages.Message) (messages.Message, error)
 		registered := msg.(*messages.Registered)
 		_, exists := w.registerRequests.LoadAndDelete(registered.RequestID())
 		if !exists {
-			return nil, fmt.Errorf("received REGISTERED for invalid requestID")
+			return nil, NewProtocolViolationError("received REGISTERED for invalid requestID")
 		}
 
 		w.registrations.Store(registered.RegistrationID(), struct{}{})
 		return registered, nil
 	case messages.MessageTypeUnregistered:
 		unregistered := msg.(*messages.Unregistered)
-		registrationID, exists := w.unregisterRequests.Load(unregistered.RequestID())
+		registrationID, exists := w.unregisterRequests.LoadAndDelete(unregistered.RequestID())
 		if !exists {
-			return nil, fmt.Errorf("received UNREGISTERED for invalid requestID")
+			return nil, NewProtocolViolationError("received UNREGISTERED for invalid requestID")
 		}
 
 		_, exists = w.registrations.LoadAndDelete(registrationID)
 		if !exists {
-			return nil, fmt.Errorf("received UNREGISTERED for invalid registrationID")
+			return nil, NewProtocolViolationError("received UNREGISTERED for invalid registrationID")
 		}
 
 		return unregistered, nil
@@ -165,25 +383,32 @@ func (w *Session) ReceiveMessage(msg messages.Message) (messages.Message, error)
 		invocation := msg.(*messages.Invocation)
 		_, exists := w.registrations.Load(invocation.RegistrationID())
 		if !exists {
-			return nil, fmt.Errorf("received INVOCATION for invalid registrationID")
+			return nil, NewProtocolViolationError("received INVOCATION for invalid registrationID")
+		}
+
+		progress, _ := invocation.Details()[OptionProgress].(bool)
+		continuation, pending := w.invocationRequests.Load(invocation.RequestID())
+		if pending && !continuation {
+			return nil, NewProtocolViolationError("received INVOCATION for request ID %d that is still pending",
+				invocation.RequestID())
 		}
 
-		w.invocationRequests.Store(invocation.RequestID(), struct{}{})
+		w.invocationRequests.Store(invocation.RequestID(), progress)
 
 		return invocation, nil
 	case messages.MessageTypePublished:
 		published := msg.(*messages.Published)
 		_, exists := w.publishRequests.LoadAndDelete(published.RequestID())
 		if !exists {
-			return nil, fmt.Errorf("received PUBLISHED for invalid requestID")
+			return nil, NewProtocolViolationError("received PUBLISHED for invalid requestID")
 		}
 
 		return published, nil
 	case messages.MessageTypeSubscribed:
 		subscribed := msg.(*messages.Subscribed)
-		_, exists := w.subscribeRequests.Load(subscribed.RequestID())
+		_, exists := w.subscribeRequests.LoadAndDelete(subscribed.RequestID())
 		if !exists {
-			return nil, fmt.Errorf("received SUBSCRIBED for invalid requestID")
+			return nil, NewProtocolViolationError("received SUBSCRIBED for invalid requestID")
 		}
 
 		w.subscriptions.Store(subscribed.SubscriptionID(), struct{}{})
@@ -191,14 +416,14 @@ func (w *Session) ReceiveMessage(msg messages.Message) (messages.Message, error)
 		return subscribed, nil
 	case messages.MessageTypeUnsubscribed:
 		unsubscribed := msg.(*messages.Unsubscribed)
-		subscriptionID, exists := w.unsubscribeRequests.Load(unsubscribed.RequestID())
+		subscriptionID, exists := w.unsubscribeRequests.LoadAndDelete(unsubscribed.RequestID())
 		if !exists {
-			return nil, fmt.Errorf("received UNSUBSCRIBED for invalid requestID")
+			return nil, NewProtocolViolationError("received UNSUBSCRIBED for invalid requestID")
 		}
 
 		_, exists = w.subscriptions.LoadAndDelete(subscriptionID)
 		if !exists {
-			return nil, fmt.Errorf("received UNSUBSCRIBED for invalid subscriptionID %d", subscriptionID)
+			return nil, NewProtocolViolationError("received UNSUBSCRIBED for invalid subscriptionID %d", subscriptionID)
 		}
 
 		return unsubscribed, nil
@@ -206,7 +431,7 @@ func (w *Session) ReceiveMessage(msg messages.Message) (messages.Message, error)
 		event := msg.(*messages.Event)
 		_, exists := w.subscriptions.Load(event.SubscriptionID())
 		if !exists {
-			return nil, fmt.Errorf("received EVENT for invalid subscriptionID")
+			return nil, NewProtocolViolationError("received EVENT for invalid subscriptionID")
 		}
 
 		return event, nil
@@ -216,53 +441,53 @@ func (w *Session) ReceiveMessage(msg messages.Message) (messages.Message, error)
 		case messages.MessageTypeCall:
 			_, exists := w.callRequests.LoadAndDelete(errorMsg.RequestID())
 			if !exists {
-				return nil, fmt.Errorf("received ERROR for invalid call request")
+				return nil, NewProtocolViolationError("received ERROR for invalid call request")
 			}
 
 			return errorMsg, nil
 		case messages.MessageTypeRegister:
 			_, exists := w.registerRequests.LoadAndDelete(errorMsg.RequestID())
 			if !exists {
-				return nil, fmt.Errorf("received ERROR for invalid register request")
+				return nil, NewProtocolViolationError("received ERROR for invalid register request")
 			}
 
 			return errorMsg, nil
 		case messages.MessageTypeUnregister:
 			_, exists := w.unregisterRequests.LoadAndDelete(errorMsg.RequestID())
 			if !exists {
-				return nil, fmt.Errorf("received ERROR for invalid unregister request")
+				return nil, NewProtocolViolationError("received ERROR for invalid unregister request")
 			}
 
 			return errorMsg, nil
 		case messages.MessageTypeSubscribe:
 			_, exists := w.subscribeRequests.LoadAndDelete(errorMsg.RequestID())
 			if !exists {
-				return nil, fmt.Errorf("received ERROR for invalid subscribe request")
+				return nil, NewProtocolViolationError("received ERROR for invalid subscribe request")
 			}
 
 			return errorMsg, nil
 		case messages.MessageTypeUnsubscribe:
 			_, exists := w.unsubscribeRequests.LoadAndDelete(errorMsg.RequestID())
 			if !exists {
-				return nil, fmt.Errorf("received ERROR for invalid unsubscribe request")
+				return nil, NewProtocolViolationError("received ERROR for invalid unsubscribe request")
 			}
 
 			return errorMsg, nil
 		case messages.MessageTypePublish:
 			_, exists := w.publishRequests.LoadAndDelete(errorMsg.RequestID())
 			if !exists {
-				return nil, fmt.Errorf("received ERROR for invalid publish request")
+				return nil, NewProtocolViolationError("received ERROR for invalid publish request")
 			}
 
 			return errorMsg, nil
 		default:
-			return nil, fmt.Errorf("unknown error message type %T", msg)
+			return nil, NewProtocolViolationError("unknown error message type %T", msg)
 		}
 	case messages.MessageTypeGoodbye:
 		return msg, nil
 	case messages.MessageTypeAbort:
 		return msg, nil
 	default:
-		return nil, fmt.Errorf("unknown message type %T", msg)
+		return nil, NewProtocolViolationError("unknown message type %T", msg)
 	}
 }
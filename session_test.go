@@ -1,6 +1,8 @@
 package wampproto_test
 
 import (
+	"errors"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -141,3 +143,174 @@ func TestSessionPublish(t *testing.T) {
 		subscribePublishAndUnsubscribe(t, topic, serializer)
 	})
 }
+
+func TestSessionRequestIDs(t *testing.T) {
+	session := wampproto.NewSession(nil)
+
+	t.Run("SkipPending", func(t *testing.T) {
+		_, err := session.SendMessage(messages.NewRegister(1, nil, "foo.bar"))
+		require.NoError(t, err)
+
+		call := session.NewCall(nil, "foo.bar", nil, nil)
+		require.Equal(t, uint64(2), call.RequestID())
+		_, err = session.SendMessage(call)
+		require.NoError(t, err)
+
+		subscribe := session.NewSubscribe(nil, "foo.bar")
+		require.Equal(t, uint64(3), subscribe.RequestID())
+	})
+
+	t.Run("RejectDuplicate", func(t *testing.T) {
+		_, err := session.SendMessage(messages.NewCall(1, nil, "foo.bar", nil, nil))
+		require.EqualError(t, err, "request ID 1 is already in use by a pending request")
+
+		_, err = session.SendMessage(messages.NewSubscribe(2, nil, "foo.bar"))
+		require.EqualError(t, err, "request ID 2 is already in use by a pending request")
+	})
+
+	t.Run("ReuseAfterCompletion", func(t *testing.T) {
+		_, err := session.ReceiveMessage(messages.NewResult(2, nil, nil, nil))
+		require.NoError(t, err)
+
+		_, err = session.SendMessage(messages.NewCall(2, nil, "foo.bar", nil, nil))
+		require.NoError(t, err)
+	})
+
+	t.Run("ProgressiveCallInvocations", func(t *testing.T) {
+		call := session.NewCall(map[string]any{wampproto.OptionProgress: true}, "foo.bar", nil, nil)
+		_, err := session.SendMessage(call)
+		require.NoError(t, err)
+
+		continuation := messages.NewCall(call.RequestID(), map[string]any{}, "foo.bar", nil, nil)
+		_, err = session.SendMessage(continuation)
+		require.NoError(t, err)
+
+		_, err = session.SendMessage(continuation)
+		require.Error(t, err)
+	})
+
+	t.Run("ConcurrentDuplicate", func(t *testing.T) {
+		session := wampproto.NewSession(nil)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := session.SendMessage(messages.NewCall(1, nil, "foo.bar", nil, nil))
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		var sent int
+		for err := range errs {
+			if err == nil {
+				sent++
+			}
+		}
+		require.Equal(t, 1, sent)
+	})
+}
+
+func TestSessionInvocationRequestIDs(t *testing.T) {
+	callee := wampproto.NewSession(nil)
+	registerProc(t, callee, "foo.bar")
+
+	invocation := messages.NewInvocation(1, 1, nil, nil, nil)
+	_, err := callee.ReceiveMessage(invocation)
+	require.NoError(t, err)
+
+	t.Run("DuplicateInvocation", func(t *testing.T) {
+		_, err := callee.ReceiveMessage(invocation)
+		require.EqualError(t, err, "received INVOCATION for request ID 1 that is still pending")
+	})
+
+	t.Run("UnknownInvocation", func(t *testing.T) {
+		_, err := callee.SendMessage(messages.NewYield(2, nil, nil, nil))
+		require.EqualError(t, err, "cannot yield for unknown invocation request 2")
+
+		errMsg := messages.NewError(messages.MessageTypeInvocation, 2, nil, "foo.error", nil, nil)
+		_, err = callee.SendMessage(errMsg)
+		require.EqualError(t, err, "cannot send error for unknown invocation request 2")
+	})
+
+	t.Run("YieldCompletesInvocation", func(t *testing.T) {
+		_, err := callee.SendMessage(messages.NewYield(1, nil, nil, nil))
+		require.NoError(t, err)
+
+		_, err = callee.SendMessage(messages.NewYield(1, nil, nil, nil))
+		require.Error(t, err)
+	})
+}
+
+type failingSerializer struct {
+	serializers.JSONSerializer
+}
+
+func (s *failingSerializer) Serialize(messages.Message) ([]byte, error) {
+	return nil, errors.New("serializer failed")
+}
+
+func TestSessionGoodbye(t *testing.T) {
+	goodbye := messages.NewGoodBye(wampproto.CloseCloseRealm, nil)
+	reply := messages.NewGoodBye(wampproto.CloseGoodByeAndOut, nil)
+
+	t.Run("Initiated", func(t *testing.T) {
+		session := wampproto.NewSession(&serializers.JSONSerializer{})
+		subscribeTopic(t, session, "foo.bar")
+
+		_, err := session.SendMessage(goodbye)
+		require.NoError(t, err)
+		require.True(t, session.Closing())
+
+		_, err = session.SendMessage(session.NewPublish(nil, "foo.bar", nil, nil))
+		require.EqualError(t, err, "cannot send *messages.Publish, GOODBYE was already sent")
+
+		// messages that were in flight are still processed
+		_, err = session.ReceiveMessage(messages.NewEvent(1, 1, nil, nil, nil))
+		require.NoError(t, err)
+
+		_, err = session.ReceiveMessage(reply)
+		require.NoError(t, err)
+		require.True(t, session.Closed())
+
+		_, err = session.ReceiveMessage(messages.NewEvent(1, 2, nil, nil, nil))
+		require.True(t, wampproto.IsProtocolViolation(err))
+	})
+
+	t.Run("Received", func(t *testing.T) {
+		session := wampproto.NewSession(&serializers.JSONSerializer{})
+		_, err := session.ReceiveMessage(goodbye)
+		require.NoError(t, err)
+		require.False(t, session.Closed())
+
+		_, err = session.SendMessage(session.NewPublish(nil, "foo.bar", nil, nil))
+		require.EqualError(t, err, "cannot send *messages.Publish, peer sent GOODBYE")
+
+		_, err = session.ReceiveMessage(messages.NewEvent(1, 1, nil, nil, nil))
+		require.True(t, wampproto.IsProtocolViolation(err))
+
+		_, err = session.SendMessage(reply)
+		require.NoError(t, err)
+		require.True(t, session.Closed())
+
+		_, err = session.SendMessage(reply)
+		require.EqualError(t, err, "cannot send *messages.GoodBye, session is closed")
+	})
+
+	t.Run("SerializationFails", func(t *testing.T) {
+		session := wampproto.NewSession(&failingSerializer{})
+		_, err := session.SendMessage(goodbye)
+		require.Error(t, err)
+		require.False(t, session.Closing())
+
+		_, err = session.ReceiveMessage(goodbye)
+		require.NoError(t, err)
+		_, err = session.SendMessage(reply)
+		require.Error(t, err)
+		require.False(t, session.Closed())
+	})
+}
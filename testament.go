@@ -0,0 +1,77 @@
+package wampproto
+
+import (
+	"fmt"
+)
+
+const (
+	// TestamentScopeDetached testaments are fired when the session is detached from its
+	// transport, including when it is suspended for resumption.
+	TestamentScopeDetached = "detached"
+	// TestamentScopeDestroyed testaments are fired when the session is destroyed. This is
+	// the default scope.
+	TestamentScopeDestroyed = "destroyed"
+
+	OptionScope = "scope"
+)
+
+// Testament is a publication the broker sends on behalf of a session when the session
+// goes away, e.g. to announce that a device is offline.
+type Testament struct {
+	Topic   string
+	Args    []any
+	KwArgs  map[string]any
+	Options map[string]any
+}
+
+// AddTestament stores a testament to be fired in the given scope.
+func (s *SessionDetails) AddTestament(scope string, testament Testament) error {
+	if scope == "" {
+		scope = TestamentScopeDestroyed
+	}
+
+	if scope != TestamentScopeDetached && scope != TestamentScopeDestroyed {
+		return fmt.Errorf("invalid testament scope %s", scope)
+	}
+
+	s.testamentsLock.Lock()
+	defer s.testamentsLock.Unlock()
+
+	if s.testaments == nil {
+		s.testaments = make(map[string][]Testament)
+	}
+
+	s.testaments[scope] = append(s.testaments[scope], testament)
+	return nil
+}
+
+// FlushTestaments removes the testaments of the given scope and returns how many
+// were removed.
+func (s *SessionDetails) FlushTestaments(scope string) (int, error) {
+	if scope == "" {
+		scope = TestamentScopeDestroyed
+	}
+
+	if scope != TestamentScopeDetached && scope != TestamentScopeDestroyed {
+		return 0, fmt.Errorf("invalid testament scope %s", scope)
+	}
+
+	return len(s.takeTestaments(scope)), nil
+}
+
+// Testaments returns the testaments stored for the given scope.
+func (s *SessionDetails) Testaments(scope string) []Testament {
+	s.testamentsLock.Lock()
+	defer s.testamentsLock.Unlock()
+
+	return append([]Testament(nil), s.testaments[scope]...)
+}
+
+func (s *SessionDetails) takeTestaments(scope string) []Testament {
+	s.testamentsLock.Lock()
+	defer s.testamentsLock.Unlock()
+
+	testaments := s.testaments[scope]
+	delete(s.testaments, scope)
+	return testaments
+}
@@ -0,0 +1,72 @@
+package auth_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/tests"
+)
+
+const (
+	testSCRAMAuthID      = "john"
+	testSCRAMSalt        = "c2FsdHNhbHRzYWx0c2FsdA=="
+	testSCRAMClientNonce = "Y2xpZW50bm9uY2VjbGllbnQ="
+	testSCRAMNonce       = testSCRAMClientNonce + "c2VydmVybm9uY2VzZXJ2ZXI="
+)
+
+func scramParams(kdf string) auth.SCRAMParams {
+	if kdf == auth.SCRAMKDFArgon2 {
+		return auth.SCRAMParams{KDF: kdf, Salt: testSCRAMSalt, Iterations: 2, Memory: 1024}
+	}
+
+	return auth.SCRAMParams{KDF: kdf, Salt: testSCRAMSalt, Iterations: 1000}
+}
+
+func TestSCRAMComputeProof(t *testing.T) {
+	for _, kdf := range []string{auth.SCRAMKDFArgon2, auth.SCRAMKDFPBKDF2} {
+		t.Run(kdf, func(t *testing.T) {
+			params := scramParams(kdf)
+			var computeProofCommand = fmt.Sprintf("auth scram compute-proof %s %s %s %s %s %s %d %d",
+				testSCRAMAuthID, testSecret, testSCRAMClientNonce, testSCRAMNonce, params.Salt, params.KDF,
+				params.Iterations, params.Memory)
+			proof, err := tests.RunCommand(computeProofCommand)
+			require.NoError(t, err)
+
+			credential, err := auth.DeriveSCRAMCredential(testSecret, params)
+			require.NoError(t, err)
+
+			authMessage := auth.SCRAMAuthMessage(testSCRAMAuthID, testSCRAMClientNonce, testSCRAMNonce, params.Salt,
+				params.Iterations, "")
+			_, err = auth.VerifySCRAMProof(credential, authMessage, proof)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSCRAMVerifyProof(t *testing.T) {
+	for _, kdf := range []string{auth.SCRAMKDFArgon2, auth.SCRAMKDFPBKDF2} {
+		t.Run(kdf, func(t *testing.T) {
+			authenticator, err := auth.NewSCRAMAuthenticator(testSCRAMAuthID, testSecret, nil)
+			require.NoError(t, err)
+
+			clientNonce := authenticator.AuthExtra()["nonce"].(string)
+			nonce := clientNonce + "c2VydmVybm9uY2VzZXJ2ZXI="
+			params := scramParams(kdf)
+			extra := map[string]any{"nonce": nonce, "salt": params.Salt, "kdf": params.KDF,
+				"iterations": params.Iterations, "memory": params.Memory}
+
+			authenticate, err := authenticator.Authenticate(*messages.NewChallenge(auth.MethodSCRAM, extra))
+			require.NoError(t, err)
+
+			var verifyProofCommand = fmt.Sprintf("auth scram verify-proof %s %s %s %s %s %s %d %d %s",
+				testSCRAMAuthID, testSecret, clientNonce, nonce, params.Salt, params.KDF, params.Iterations,
+				params.Memory, authenticate.Signature())
+			_, err = tests.RunCommand(verifyProofCommand)
+			require.NoError(t, err)
+		})
+	}
+}
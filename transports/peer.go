@@ -0,0 +1,192 @@
+package transports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	HandshakeErrSerializerUnsupported   byte = 1
+	HandshakeErrMaxMessageLengthInvalid byte = 2
+	HandshakeErrUseOfReservedBits       byte = 3
+	HandshakeErrMaxConnectionCount      byte = 4
+)
+
+// Peer is a message oriented WAMP transport connection.
+type Peer interface {
+	Read() ([]byte, error)
+	Write(data []byte) error
+	Close() error
+	NetConn() net.Conn
+}
+
+// RawSocketPeer implements Peer on top of a stream connection using the WAMP rawsocket framing.
+type RawSocketPeer struct {
+	conn net.Conn
+
+	// maximum size of messages this side is willing to receive
+	maxReceiveSize int
+	// maximum size of messages the other side is willing to receive
+	maxSendSize int
+
+	sync.Mutex
+}
+
+func NewRawSocketPeer(conn net.Conn, maxReceiveSize, maxSendSize int) *RawSocketPeer {
+	return &RawSocketPeer{
+		conn:           conn,
+		maxReceiveSize: maxReceiveSize,
+		maxSendSize:    maxSendSize,
+	}
+}
+
+// DialRawSocket connects to a rawsocket server at the given address and performs
+// the opening handshake.
+func DialRawSocket(ctx context.Context, network, address string, serializer Serializer,
+	maxMessageSize int) (*RawSocketPeer, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	peer, err := handshakeClient(conn, serializer, maxMessageSize)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return peer, nil
+}
+
+func handshakeClient(conn net.Conn, serializer Serializer, maxMessageSize int) (*RawSocketPeer, error) {
+	request, err := SendHandshake(NewHandshake(serializer, maxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = conn.Write(request); err != nil {
+		return nil, fmt.Errorf("failed to send handshake: %w", err)
+	}
+
+	reply := make([]byte, 4)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("failed to read handshake: %w", err)
+	}
+
+	if reply[0] == MAGIC && reply[1]&0x0F == 0 {
+		return nil, fmt.Errorf("router rejected handshake with error %d", reply[1]>>4)
+	}
+
+	response, err := ReceiveHandshake(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Serializer() != serializer {
+		return nil, fmt.Errorf("router replied with serializer %d, requested %d", response.Serializer(), serializer)
+	}
+
+	return NewRawSocketPeer(conn, maxMessageSize, response.MaxMessageSize()), nil
+}
+
+// AcceptRawSocket performs the server side of the rawsocket opening handshake on
+// an accepted connection. Only serializers for which supported returns true are
+// accepted.
+func AcceptRawSocket(conn net.Conn, maxMessageSize int, supported func(Serializer) bool) (*RawSocketPeer,
+	Serializer, error) {
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, 0, fmt.Errorf("failed to read handshake: %w", err)
+	}
+
+	hs, err := ReceiveHandshake(request)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if supported != nil && !supported(hs.Serializer()) {
+		_, _ = conn.Write([]byte{MAGIC, HandshakeErrSerializerUnsupported << 4, 0x00, 0x00})
+		return nil, 0, fmt.Errorf("unsupported serializer %d", hs.Serializer())
+	}
+
+	response, err := SendHandshake(NewHandshake(hs.Serializer(), maxMessageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if _, err = conn.Write(response); err != nil {
+		return nil, 0, fmt.Errorf("failed to send handshake: %w", err)
+	}
+
+	return NewRawSocketPeer(conn, maxMessageSize, hs.MaxMessageSize()), hs.Serializer(), nil
+}
+
+// Read returns the next WAMP message, transparently answering pings.
+func (r *RawSocketPeer) Read() ([]byte, error) {
+	for {
+		headerRaw := make([]byte, 4)
+		if _, err := io.ReadFull(r.conn, headerRaw); err != nil {
+			return nil, err
+		}
+
+		header, err := ReceiveMessageHeader(headerRaw)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Length() > r.maxReceiveSize {
+			return nil, fmt.Errorf("message of size %d exceeds limit %d", header.Length(), r.maxReceiveSize)
+		}
+
+		payload := make([]byte, header.Length())
+		if _, err = io.ReadFull(r.conn, payload); err != nil {
+			return nil, err
+		}
+
+		switch header.Kind() {
+		case MessageWamp:
+			return payload, nil
+		case MessagePing:
+			if err = r.write(MessagePong, payload); err != nil {
+				return nil, err
+			}
+		case MessagePong:
+			continue
+		default:
+			return nil, fmt.Errorf("received message of unknown kind %d", header.Kind())
+		}
+	}
+}
+
+func (r *RawSocketPeer) Write(data []byte) error {
+	return r.write(MessageWamp, data)
+}
+
+func (r *RawSocketPeer) write(kind Message, data []byte) error {
+	if len(data) > r.maxSendSize {
+		return errors.New("message exceeds maximum size accepted by peer")
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	header := SendMessageHeader(NewMessageHeader(kind, len(data)))
+	if _, err := r.conn.Write(append(header, data...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *RawSocketPeer) Close() error {
+	return r.conn.Close()
+}
+
+func (r *RawSocketPeer) NetConn() net.Conn {
+	return r.conn
+}
@@ -1,6 +1,8 @@
 package wampproto
 
 import (
+	"sync"
+
 	"github.com/xconnio/wampproto-go/auth"
 	"github.com/xconnio/wampproto-go/messages"
 )
@@ -15,6 +17,18 @@ type SessionDetails struct {
 	authExtra   map[string]any
 	authMethod  string
 
+	clientAuthExtra map[string]any
+
+	authProvider string
+
+	resumeToken string
+	resumed     bool
+
+	features map[string]map[string]bool
+
+	testaments     map[string][]Testament
+	testamentsLock sync.Mutex
+
 	staticSerializer bool
 }
 
@@ -59,6 +73,11 @@ func (s *SessionDetails) AuthMethod() string {
 	return s.authMethod
 }
 
+// AuthProvider returns the authprovider announced in WELCOME.
+func (s *SessionDetails) AuthProvider() string {
+	return s.authProvider
+}
+
 func (s *SessionDetails) StaticSerializer() bool {
 	return s.staticSerializer
 }
@@ -75,6 +94,39 @@ func (s *SessionDetails) AuthExtra() map[string]any {
 	return s.authExtra
 }
 
+// ClientAuthExtra returns the authextra the client sent in AUTHENTICATE. Unlike
+// AuthExtra it is not vouched for by the authenticator and must not be trusted.
+func (s *SessionDetails) ClientAuthExtra() map[string]any {
+	return s.clientAuthExtra
+}
+
+// ResumeToken returns the token to resume this session with after a reconnect, or an
+// empty string if the session is not resumable.
+func (s *SessionDetails) ResumeToken() string {
+	return s.resumeToken
+}
+
+// Resumed reports whether the session continues an earlier session that was detached.
+func (s *SessionDetails) Resumed() bool {
+	return s.resumed
+}
+
+// HasFeature reports whether the client announced the feature for the given client role and
+// the router supports it too. Details that were not created by an Acceptor or a Joiner carry
+// no negotiated features and support everything.
+func (s *SessionDetails) HasFeature(role, feature string) bool {
+	if s.features == nil {
+		return true
+	}
+
+	return s.features[role][feature]
+}
+
+// Features returns the features negotiated per client role, or nil if they are unknown.
+func (s *SessionDetails) Features() map[string]map[string]bool {
+	return s.features
+}
+
 type MessageWithRecipient struct {
 	Message   messages.Message
 	Recipient uint64
@@ -0,0 +1,63 @@
+package wampproto
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type URIValidationMode uint
+
+const (
+	// URIValidationLoose allows any URI component that has no whitespace, "." or "#".
+	URIValidationLoose URIValidationMode = iota
+	// URIValidationStrict only allows lowercase letters, digits and "_" in components.
+	URIValidationStrict
+)
+
+// ReservedURIPrefix starts URIs that only the router may register or publish to.
+const ReservedURIPrefix = "wamp."
+
+var (
+	looseURIRegex           = regexp.MustCompile(`^([^\s.#]+\.)*([^\s.#]+)$`)           //nolint:gochecknoglobals
+	looseURIRegexWithEmpty  = regexp.MustCompile(`^(([^\s.#]+\.)|\.)*([^\s.#]+)?$`)     //nolint:gochecknoglobals
+	strictURIRegex          = regexp.MustCompile(`^([0-9a-z_]+\.)*([0-9a-z_]+)$`)       //nolint:gochecknoglobals
+	strictURIRegexWithEmpty = regexp.MustCompile(`^(([0-9a-z_]+\.)|\.)*([0-9a-z_]+)?$`) //nolint:gochecknoglobals
+)
+
+// ValidateURI checks uri against the URI rules of the WAMP spec. Empty components are
+// only allowed in prefix and wildcard patterns, so allowEmptyComponents should be set when
+// validating the URI of such a registration or subscription.
+func ValidateURI(uri string, mode URIValidationMode, allowEmptyComponents bool) error {
+	var regex *regexp.Regexp
+	switch {
+	case mode == URIValidationStrict && allowEmptyComponents:
+		regex = strictURIRegexWithEmpty
+	case mode == URIValidationStrict:
+		regex = strictURIRegex
+	case allowEmptyComponents:
+		regex = looseURIRegexWithEmpty
+	default:
+		regex = looseURIRegex
+	}
+
+	if uri == "" || !regex.MatchString(uri) {
+		return fmt.Errorf("invalid URI %q", uri)
+	}
+
+	return nil
+}
+
+// validateURI validates the URI of a REGISTER, CALL, SUBSCRIBE or PUBLISH. Clients may
+// not register procedures or publish to topics with the reserved "wamp." prefix.
+func validateURI(uri, match string, mode URIValidationMode, reserved bool) error {
+	if err := ValidateURI(uri, mode, match == MatchPrefix || match == MatchWildcard); err != nil {
+		return err
+	}
+
+	if reserved && strings.HasPrefix(uri, ReservedURIPrefix) {
+		return fmt.Errorf("URI %q uses the reserved prefix %q", uri, ReservedURIPrefix)
+	}
+
+	return nil
+}
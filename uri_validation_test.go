@@ -0,0 +1,102 @@
+package wampproto_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/serializers"
+)
+
+func TestValidateURI(t *testing.T) {
+	tests := []struct {
+		uri        string
+		mode       wampproto.URIValidationMode
+		allowEmpty bool
+		valid      bool
+	}{
+		{"com.example.procedure", wampproto.URIValidationLoose, false, true},
+		{"com.Example.Procedure-1", wampproto.URIValidationLoose, false, true},
+		{"com.Example.Procedure-1", wampproto.URIValidationStrict, false, false},
+		{"com.example.procedure_1", wampproto.URIValidationStrict, false, true},
+		{"com.example procedure", wampproto.URIValidationLoose, false, false},
+		{"com.example#procedure", wampproto.URIValidationLoose, false, false},
+		{"", wampproto.URIValidationLoose, false, false},
+		{"com..procedure", wampproto.URIValidationLoose, false, false},
+		{"com..procedure", wampproto.URIValidationLoose, true, true},
+		{"com.example.", wampproto.URIValidationLoose, false, false},
+		{"com.example.", wampproto.URIValidationLoose, true, true},
+		{"com..procedure", wampproto.URIValidationStrict, true, true},
+		{"com..Procedure", wampproto.URIValidationStrict, true, false},
+	}
+
+	for _, test := range tests {
+		err := wampproto.ValidateURI(test.uri, test.mode, test.allowEmpty)
+		if test.valid {
+			require.NoError(t, err, test.uri)
+		} else {
+			require.Error(t, err, test.uri)
+		}
+	}
+}
+
+func TestDealerURIValidation(t *testing.T) {
+	dealer := wampproto.NewDealer()
+	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, dealer.AddSession(details))
+
+	requireInvalidURI := func(msg messages.Message) {
+		result, err := dealer.ReceiveMessage(details.ID(), msg)
+		require.NoError(t, err)
+		errMsg, ok := result.Message.(*messages.Error)
+		require.True(t, ok)
+		require.Equal(t, wampproto.ErrInvalidURI, errMsg.URI())
+	}
+
+	requireInvalidURI(messages.NewRegister(1, nil, "wamp.session.count"))
+	requireInvalidURI(messages.NewRegister(2, nil, "foo..bar"))
+	requireInvalidURI(messages.NewCall(3, nil, "foo bar", nil, nil))
+
+	options := map[string]any{wampproto.OptionMatch: wampproto.MatchWildcard}
+	result, err := dealer.ReceiveMessage(details.ID(), messages.NewRegister(4, options, "foo..bar"))
+	require.NoError(t, err)
+	require.Equal(t, messages.MessageTypeRegistered, result.Message.Type())
+
+	dealer.SetURIValidation(wampproto.URIValidationStrict)
+	requireInvalidURI(messages.NewRegister(5, nil, "Foo.Bar"))
+}
+
+func TestBrokerURIValidation(t *testing.T) {
+	broker := wampproto.NewBroker()
+	details := wampproto.NewSessionDetails(1, "realm", "authid", "anonymous", "", false,
+		wampproto.DefaultRouterRoles(), nil)
+	require.NoError(t, broker.AddSession(details))
+
+	result, err := broker.ReceiveMessage(details.ID(), messages.NewSubscribe(1, nil, "wamp.session.on_join"))
+	require.NoError(t, err)
+	require.Equal(t, messages.MessageTypeSubscribed, result.Message.Type())
+
+	result, err = broker.ReceiveMessage(details.ID(), messages.NewSubscribe(2, nil, "foo..bar"))
+	require.NoError(t, err)
+	require.Equal(t, wampproto.ErrInvalidURI, result.Message.(*messages.Error).URI())
+
+	options := map[string]any{wampproto.OptAcknowledge: true}
+	publication, err := broker.ReceivePublish(details.ID(), messages.NewPublish(3, options, "wamp.session.on_join",
+		nil, nil))
+	require.NoError(t, err)
+	require.Nil(t, publication.Event)
+	require.Equal(t, wampproto.ErrInvalidURI, publication.Ack.Message.(*messages.Error).URI())
+}
+
+func TestAcceptorInvalidRealm(t *testing.T) {
+	serializer := &serializers.JSONSerializer{}
+	acceptor := wampproto.NewAcceptor(serializer, nil)
+	hello := messages.NewHello("invalid realm", "", nil, wampproto.DefaultClientRoles(), []string{"anonymous"})
+
+	abort, err := acceptor.ReceiveMessage(hello)
+	require.NoError(t, err)
+	require.Equal(t, wampproto.ErrInvalidURI, abort.(*messages.Abort).Reason())
+}
@@ -35,3 +35,9 @@ const (
 	ErrProtocolViolation          = "wamp.error.protocol_violation"
 	ErrNotAuthorized              = "wamp.error.not_authorized"
 )
+
+const (
+	MetaProcSubscriptionGetEvents  = "wamp.subscription.get_events"
+	MetaProcSessionAddTestament    = "wamp.session.add_testament"
+	MetaProcSessionFlushTestaments = "wamp.session.flush_testaments"
+)